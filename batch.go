@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchRun is the result of a run of a program with an input file or with the
+// input values of a sweep.
+type batchRun struct {
+	// Input is the input file or the comma separated input values.
+	Input        string        `json:"input"`
+	Output       ints          `json:"output"`
+	Steps        int           `json:"steps"`
+	ExecDuration time.Duration `json:"exec_duration_ns"`
+	PeakMemory   int           `json:"peak_memory"`
+	Stats        *Stats        `json:"stats,omitempty"`
+	// Error is the reason of a failed run, which has crashed at IP.
+	Error string `json:"error,omitempty"`
+	IP    int    `json:"ip,omitempty"`
+}
+
+// batchInput is the input of a run, either a file or input values.
+type batchInput struct {
+	Filename string
+	Values   ints
+}
+
+func (in batchInput) String() string {
+	if in.Filename != "" {
+		return in.Filename
+	}
+	return in.Values.String()
+}
+
+// fileInputs returns the batch inputs of the files.
+func fileInputs(filenames []string) []batchInput {
+	inputs := make([]batchInput, len(filenames))
+	for i, filename := range filenames {
+		inputs[i].Filename = filename
+	}
+	return inputs
+}
+
+// sweepInputs returns a batch input for every combination of the values of the
+// parameters, which are the input values in their order. The first parameter
+// changes slowest.
+func sweepInputs(params []ints) ([]batchInput, error) {
+	total := 1
+	for _, values := range params {
+		if len(values) > maxBatchRuns/total {
+			return nil, fmt.Errorf("sweep exceeds %d runs", maxBatchRuns)
+		}
+		total *= len(values)
+	}
+	inputs := make([]batchInput, total)
+	for i := range inputs {
+		values := make(ints, len(params))
+		rest := i
+		for j := len(params) - 1; j >= 0; j-- {
+			values[j] = params[j][rest%len(params[j])]
+			rest /= len(params[j])
+		}
+		inputs[i].Values = values
+	}
+	return inputs, nil
+}
+
+// maxBatchRuns is the maximum number of runs of a sweep.
+const maxBatchRuns = 1 << 24
+
+// sweepFlag is a repeatable flag of the values of a sweep parameter.
+type sweepFlag struct {
+	params *[]ints
+}
+
+func (f sweepFlag) String() string {
+	if f.params == nil {
+		return ""
+	}
+	var params []string
+	for _, values := range *f.params {
+		params = append(params, values.String())
+	}
+	return strings.Join(params, " ")
+}
+
+func (f sweepFlag) Set(str string) error {
+	values, err := parseValueRanges(str, maxBatchRuns)
+	if err != nil {
+		return fmt.Errorf("invalid sweep %q: %v", str, err)
+	}
+	*f.params = append(*f.params, values)
+	return nil
+}
+
+// runBatch runs the program of base with each of the inputs on workers many
+// goroutines. Before a run, setup configures the program, e.g. by activating
+// the stats. The runs are passed to report in the order of the inputs.
+func runBatch(base *Snapshot, inputs []batchInput, workers int, setup func(p *Program), report func(run *batchRun)) {
+	jobs := make(chan int)
+	type result struct {
+		index int
+		run   *batchRun
+	}
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results <- result{index, runBatchInput(base, inputs[index], setup)}
+			}
+		}()
+	}
+	go func() {
+		for index := range inputs {
+			jobs <- index
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Keep the finished runs until the previous runs have been reported
+	pending := map[int]*batchRun{}
+	next := 0
+	for r := range results {
+		pending[r.index] = r.run
+		for pending[next] != nil {
+			report(pending[next])
+			delete(pending, next)
+			next++
+		}
+	}
+}
+
+// runBatchInput restores the program from base and runs it with the input. A
+// crash of the program is recorded as the error of the run.
+func runBatchInput(base *Snapshot, input batchInput, setup func(p *Program)) *batchRun {
+	run := &batchRun{Input: input.String(), Output: ints{}}
+	p := &Program{DebugWriter: ioutil.Discard}
+	p.Restore(base)
+	if input.Filename != "" {
+		data, err := ioutil.ReadFile(input.Filename)
+		if err != nil {
+			run.Error = err.Error()
+			return run
+		}
+		p.InputReader = bytes.NewReader(data)
+	} else {
+		p.InputSource = NewValuesInput(input.Values...)
+	}
+	var output bytes.Buffer
+	p.OutputWriter = &output
+	setup(p)
+
+	start := time.Now()
+	err := p.execRecover()
+	run.ExecDuration = time.Since(start)
+	run.Steps = p.Steps
+	run.PeakMemory = len(p.Ints)
+	if p.Stats.Activated {
+		run.Stats = &p.Stats
+	}
+	if err != nil {
+		run.Error = err.Error()
+		run.IP = p.IP
+	}
+	// Outputs are newline separated ints
+	run.Output, _ = newParser(&output).parse()
+	return run
+}
+
+// batchReport writes the runs of a batch in a format.
+type batchReport interface {
+	write(run *batchRun) error
+	// flush writes buffered runs.
+	flush() error
+}
+
+// batchFormats create a batch report writing to w by the name of its format.
+var batchFormats = map[string]func(w io.Writer) batchReport{
+	"jsonl": func(w io.Writer) batchReport { return &jsonlReport{json.NewEncoder(w)} },
+	"csv":   func(w io.Writer) batchReport { return &csvReport{w: csv.NewWriter(w)} },
+}
+
+// batchFormatNames returns the sorted names of the batch report formats.
+func batchFormatNames() []string {
+	names := make([]string, 0, len(batchFormats))
+	for name := range batchFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// jsonlReport writes a JSON object per line and run.
+type jsonlReport struct {
+	enc *json.Encoder
+}
+
+func (r *jsonlReport) write(run *batchRun) error {
+	return r.enc.Encode(run)
+}
+
+func (r *jsonlReport) flush() error {
+	return nil
+}
+
+// csvReport writes a header and a record per run. The output values are
+// joined by commas, and the operations and memory accesses are empty if the
+// stats are not activated.
+type csvReport struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (r *csvReport) write(run *batchRun) error {
+	if !r.header {
+		r.header = true
+		header := []string{"input", "error", "ip", "steps", "exec_duration_ns", "peak_memory",
+			"total_operations", "total_memory_accesses", "output"}
+		if err := r.w.Write(header); err != nil {
+			return err
+		}
+	}
+	operations, accesses := "", ""
+	if run.Stats != nil {
+		operations = strconv.FormatUint(uint64(run.Stats.TotalOperations), 10)
+		accesses = strconv.FormatUint(uint64(run.Stats.TotalMemoryAccesses), 10)
+	}
+	return r.w.Write([]string{
+		run.Input,
+		run.Error,
+		strconv.Itoa(run.IP),
+		strconv.Itoa(run.Steps),
+		strconv.FormatInt(run.ExecDuration.Nanoseconds(), 10),
+		strconv.Itoa(run.PeakMemory),
+		operations,
+		accesses,
+		run.Output.String(),
+	})
+}
+
+func (r *csvReport) flush() error {
+	r.w.Flush()
+	return r.w.Error()
+}
+
+// batchCommand runs a program with many input files or with the combinations
+// of a parameter sweep in parallel and reports the results of the successful
+// and of the failed runs separately.
+func batchCommand(args []string) {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s batch <flags> <program> <inputs...>\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "       %s batch <flags> -sweep <values> [-sweep <values>...] <program>\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	workers := fs.Int("workers", runtime.GOMAXPROCS(0), "Number of programs run in parallel")
+	format := fs.String("format", "jsonl", "Format of the reports ("+strings.Join(batchFormatNames(), ", ")+")")
+	reportFilename := fs.String("o", "", "File to write the report of the successful runs to instead of stdout")
+	failuresFilename := fs.String("failures", "", "File to write the report of the failed runs to instead of stderr")
+	memory := fs.Uint("mem", 42, "Number of ints that are allocated for the memory in addition to the program")
+	stats := fs.Bool("stats", false, "Add the stats of every run to the report")
+	optimize := fs.Bool("optimize", false, "Fuse idioms and sequences of instructions into superinstructions")
+	loopInterval := fs.Int("detect-loops", 0, "Number of executed instructions between two checks for infinite loops, "+
+		"which fail the run")
+	var sweep []ints
+	fs.Var(sweepFlag{params: &sweep}, "sweep", "Input value of the runs as comma separated values or inclusive "+
+		"ranges, e.g. 0..99 or 1,3,10..20, instead of input files. Repeated for the next input values, whose "+
+		"combinations are run, where the first one changes slowest")
+	fs.Parse(args)
+	if fs.NArg() < 1 || *workers < 1 || (len(sweep) == 0) == (fs.NArg() < 2) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	newReport, ok := batchFormats[*format]
+	if !ok {
+		panic("Unknown batch format " + *format)
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	p, err := NewFromReader(file, *memory)
+	file.Close()
+	if err != nil {
+		panic(fmt.Sprintf("%s: %v", fs.Arg(0), err))
+	}
+	base := p.Snapshot()
+	inputs := fileInputs(fs.Args()[1:])
+	if len(sweep) > 0 {
+		if inputs, err = sweepInputs(sweep); err != nil {
+			panic(err)
+		}
+	}
+
+	reportFile, failuresFile := os.Stdout, os.Stderr
+	if *reportFilename != "" {
+		reportFile, err = os.OpenFile(*reportFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+		if err != nil {
+			panic(err)
+		}
+		defer reportFile.Close()
+	}
+	if *failuresFilename != "" {
+		failuresFile, err = os.OpenFile(*failuresFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+		if err != nil {
+			panic(err)
+		}
+		defer failuresFile.Close()
+	}
+	report, failures := newReport(reportFile), newReport(failuresFile)
+
+	failed := 0
+	start := time.Now()
+	runBatch(base, inputs, *workers, func(p *Program) {
+		p.Optimize = *optimize
+		if *stats {
+			p.Stats = NewStats()
+		}
+		if *loopInterval > 0 {
+			p.Loop = newLoopDetector(*loopInterval)
+		}
+	}, func(run *batchRun) {
+		r := report
+		if run.Error != "" {
+			r = failures
+			failed++
+		}
+		if err := r.write(run); err != nil {
+			panic(err)
+		}
+	})
+	if err := report.flush(); err != nil {
+		panic(err)
+	}
+	if err := failures.flush(); err != nil {
+		panic(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%d runs, %d failed in %s\n", len(inputs), failed, time.Since(start).Round(time.Millisecond))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
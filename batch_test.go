@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeInputs writes the inputs into files of dir and returns their names.
+func writeInputs(t *testing.T, dir string, inputs ...string) []string {
+	var filenames []string
+	for i, input := range inputs {
+		filename := filepath.Join(dir, "input"+strconv.Itoa(i))
+		assert.NoError(t, ioutil.WriteFile(filename, []byte(input), 0664))
+		filenames = append(filenames, filename)
+	}
+	return filenames
+}
+
+func TestRunBatch(t *testing.T) {
+	var inputs []string
+	for i := 1; i <= 50; i++ {
+		inputs = append(inputs, strconv.Itoa(i)+" 7")
+	}
+	inputs = append(inputs, "1 x")
+	filenames := writeInputs(t, t.TempDir(), inputs...)
+	filenames = append(filenames, filepath.Join(t.TempDir(), "missing"))
+	base := New(countdown, 10).Snapshot()
+
+	var runs []*batchRun
+	runBatch(base, fileInputs(filenames), 4, func(p *Program) {
+		p.Stats = NewStats()
+	}, func(run *batchRun) {
+		runs = append(runs, run)
+	})
+	assert.Len(t, runs, 52)
+	for i, run := range runs[:50] {
+		assert.Equal(t, filenames[i], run.Input)
+		assert.Empty(t, run.Error)
+		assert.Len(t, run.Output, i+2)
+		assert.Equal(t, int64(i+1), run.Output[0])
+		assert.Equal(t, int64(7), run.Output[i+1])
+		assert.Equal(t, 3*(i+1)+4, run.Steps)
+		assert.Equal(t, uint(run.Steps), run.Stats.TotalOperations)
+		assert.Equal(t, 102, run.PeakMemory)
+	}
+	assert.Equal(t, "expected integer", runs[50].Error)
+	assert.Equal(t, ints{1}, runs[50].Output)
+	assert.Equal(t, 11, runs[50].IP)
+	assert.Contains(t, runs[51].Error, "no such file or directory")
+}
+
+func TestRunBatch_Sweep(t *testing.T) {
+	var sweep []ints
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Var(sweepFlag{params: &sweep}, "sweep", "")
+	assert.NoError(t, fs.Parse([]string{"-sweep", "1..3", "-sweep", "7,9"}))
+	assert.Equal(t, []ints{{1, 2, 3}, {7, 9}}, sweep)
+	// The values are not built beyond the maximum number of runs
+	assert.EqualError(t, fs.Parse([]string{"-sweep", "0..100000000000"}), `invalid value "0..100000000000" for flag -sweep: invalid sweep "0..100000000000": too many values`)
+	assert.EqualError(t, fs.Parse([]string{"-sweep", "3..1"}), `invalid value "3..1" for flag -sweep: invalid sweep "3..1": invalid values "3..1"`)
+
+	inputs, err := sweepInputs(sweep)
+	assert.NoError(t, err)
+	var runs []*batchRun
+	runBatch(New(countdown, 10).Snapshot(), inputs, 4, func(p *Program) {}, func(run *batchRun) {
+		runs = append(runs, run)
+	})
+	assert.Len(t, runs, 6)
+	for i, expected := range []struct {
+		input  string
+		output ints
+	}{
+		{"1,7", ints{1, 7}}, {"1,9", ints{1, 9}},
+		{"2,7", ints{2, 1, 7}}, {"2,9", ints{2, 1, 9}},
+		{"3,7", ints{3, 2, 1, 7}}, {"3,9", ints{3, 2, 1, 9}},
+	} {
+		assert.Equal(t, expected.input, runs[i].Input)
+		assert.Empty(t, runs[i].Error)
+		assert.Equal(t, expected.output, runs[i].Output)
+	}
+
+	_, err = sweepInputs([]ints{make(ints, 1<<12), make(ints, 1<<12), make(ints, 2)})
+	assert.EqualError(t, err, "sweep exceeds 16777216 runs")
+}
+
+func TestBatchFormats(t *testing.T) {
+	runs := []*batchRun{
+		{Input: "a", Output: ints{1, 2}, Steps: 3, ExecDuration: 40, PeakMemory: 50},
+		{Input: "b", Output: ints{}, Error: "expected integer", IP: 4},
+	}
+	for format, expected := range map[string]string{
+		"jsonl": `{"input":"a","output":[1,2],"steps":3,"exec_duration_ns":40,"peak_memory":50}` + "\n" +
+			`{"input":"b","output":[],"steps":0,"exec_duration_ns":0,"peak_memory":0,"error":"expected integer","ip":4}` + "\n",
+		"csv": "input,error,ip,steps,exec_duration_ns,peak_memory,total_operations,total_memory_accesses,output\n" +
+			"a,,0,3,40,50,,,\"1,2\"\n" +
+			"b,expected integer,4,0,0,0,,,\n",
+	} {
+		var b strings.Builder
+		report := batchFormats[format](&b)
+		for _, run := range runs {
+			assert.NoError(t, report.write(run))
+		}
+		assert.NoError(t, report.flush())
+		assert.Equal(t, expected, b.String(), format)
+	}
+}
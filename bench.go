@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// benchSummary summarizes the measurements of multiple runs.
+type benchSummary struct {
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	Stddev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// newBenchSummary calculates the summary of the values. The sample standard
+// deviation is used.
+func newBenchSummary(values []float64) benchSummary {
+	if len(values) == 0 {
+		return benchSummary{}
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	s := benchSummary{Min: sorted[0], Max: sorted[len(sorted)-1]}
+	for _, v := range sorted {
+		s.Mean += v
+	}
+	s.Mean /= float64(len(sorted))
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		s.Median = (sorted[middle-1] + sorted[middle]) / 2
+	} else {
+		s.Median = sorted[middle]
+	}
+
+	if len(sorted) > 1 {
+		for _, v := range sorted {
+			s.Stddev += (v - s.Mean) * (v - s.Mean)
+		}
+		s.Stddev = math.Sqrt(s.Stddev / float64(len(sorted)-1))
+	}
+	return s
+}
+
+// benchResult is the result of a benchmark, which can be saved as a baseline.
+type benchResult struct {
+	Program string `json:"program"`
+	Runs    int    `json:"runs"`
+	// ExecDuration is the summary of the execution durations in nanoseconds.
+	ExecDuration        benchSummary `json:"exec_duration_ns"`
+	OperationsPerSecond benchSummary `json:"operations_per_second"`
+}
+
+// runBench executes the program source runs many times after warmup many runs,
+// which are not measured. Each run reads input from the beginning. The stats
+// are not activated, so that the fast dispatch loop is measured.
+func runBench(source string, input []byte, runs int, warmup int) *benchResult {
+	var durations, opsPerSecond []float64
+	for i := 0; i < warmup+runs; i++ {
+		p := New(source, additionalMemory)
+		p.InputReader = bytes.NewReader(input)
+		p.OutputWriter = ioutil.Discard
+		start := time.Now()
+		p.Exec()
+		duration := time.Since(start)
+		if i < warmup {
+			continue
+		}
+		durations = append(durations, float64(duration.Nanoseconds()))
+		opsPerSecond = append(opsPerSecond, float64(p.Steps)/duration.Seconds())
+	}
+	return &benchResult{
+		Runs:                runs,
+		ExecDuration:        newBenchSummary(durations),
+		OperationsPerSecond: newBenchSummary(opsPerSecond),
+	}
+}
+
+// print writes the result to w.
+func (r *benchResult) print(w io.Writer) {
+	d := r.ExecDuration
+	fmt.Fprintf(w, "%d runs of %s\n", r.Runs, r.Program)
+	fmt.Fprintf(w, "%-16s %12s %12s %12s %12s %12s\n", "", "mean", "median", "stddev", "min", "max")
+	fmt.Fprintf(w, "%-16s %12s %12s %12s %12s %12s\n", "exec duration",
+		nanos(d.Mean), nanos(d.Median), nanos(d.Stddev), nanos(d.Min), nanos(d.Max))
+	o := r.OperationsPerSecond
+	fmt.Fprintf(w, "%-16s %12.0f %12.0f %12.0f %12.0f %12.0f\n", "ops/sec", o.Mean, o.Median, o.Stddev, o.Min, o.Max)
+}
+
+// nanos formats nanoseconds as a duration.
+func nanos(ns float64) string {
+	return time.Duration(ns).Round(time.Microsecond / 10).String()
+}
+
+// compare writes the changes of the means compared to the baseline to w. It
+// reports whether the exec duration has increased or the operations per second
+// have decreased by more than threshold percent.
+func (r *benchResult) compare(w io.Writer, baseline *benchResult, threshold float64) bool {
+	durationChange := change(baseline.ExecDuration.Mean, r.ExecDuration.Mean)
+	opsChange := change(baseline.OperationsPerSecond.Mean, r.OperationsPerSecond.Mean)
+	regression := durationChange > threshold || -opsChange > threshold
+
+	fmt.Fprintf(w, "Compared to baseline: exec duration %+.1f%%, ops/sec %+.1f%%\n", durationChange, opsChange)
+	if regression {
+		fmt.Fprintf(w, "Regression above threshold of %.1f%%\n", threshold)
+	}
+	return regression
+}
+
+// change returns the change from old to new in percent.
+func change(old float64, new float64) float64 {
+	if old == 0 {
+		return 0
+	}
+	return (new - old) / old * 100
+}
+
+// benchCommand benchmarks a program and compares the result to a baseline.
+func benchCommand(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s bench <flags> <program>\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	runs := fs.Int("runs", 10, "Number of measured runs")
+	warmup := fs.Int("warmup", 2, "Number of runs before the measured runs")
+	inputFilename := fs.String("input", "", "File to read the input values of every run from")
+	baselineFilename := fs.String("baseline", "", "File of a saved result to compare against")
+	saveFilename := fs.String("save", "", "File to save the result to, e.g. as a new baseline")
+	threshold := fs.Float64("threshold", 5, "Change in percent of the mean exec duration or ops/sec, which is a regression")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *runs < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	source, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	var input []byte
+	if *inputFilename != "" {
+		if input, err = ioutil.ReadFile(*inputFilename); err != nil {
+			panic(err)
+		}
+	}
+
+	result := runBench(string(source), input, *runs, *warmup)
+	result.Program = fs.Arg(0)
+	result.print(os.Stdout)
+
+	if *saveFilename != "" {
+		text, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		if err := ioutil.WriteFile(*saveFilename, text, 0664); err != nil {
+			panic(err)
+		}
+	}
+
+	if *baselineFilename != "" {
+		text, err := ioutil.ReadFile(*baselineFilename)
+		if err != nil {
+			panic(err)
+		}
+		baseline := &benchResult{}
+		if err := json.Unmarshal(text, baseline); err != nil {
+			panic(fmt.Errorf("%s: %w", *baselineFilename, err))
+		}
+		if result.compare(os.Stdout, baseline, *threshold) {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewBenchSummary(t *testing.T) {
+	s := newBenchSummary([]float64{4, 1, 3, 2})
+	assert.Equal(t, 2.5, s.Mean)
+	assert.Equal(t, 2.5, s.Median)
+	assert.InDelta(t, 1.291, s.Stddev, 0.001)
+	assert.Equal(t, 1.0, s.Min)
+	assert.Equal(t, 4.0, s.Max)
+
+	s = newBenchSummary([]float64{3})
+	assert.Equal(t, benchSummary{Mean: 3, Median: 3, Min: 3, Max: 3}, s)
+}
+
+func TestRunBench(t *testing.T) {
+	r := runBench("3,7,4,7,99", []byte("42"), 3, 1)
+	assert.Equal(t, 3, r.Runs)
+	assert.True(t, r.ExecDuration.Mean > 0)
+}
+
+func TestBenchResult_Compare(t *testing.T) {
+	baseline := &benchResult{
+		ExecDuration:        benchSummary{Mean: 100},
+		OperationsPerSecond: benchSummary{Mean: 1000},
+	}
+	var out bytes.Buffer
+	faster := &benchResult{
+		ExecDuration:        benchSummary{Mean: 90},
+		OperationsPerSecond: benchSummary{Mean: 1100},
+	}
+	assert.False(t, faster.compare(&out, baseline, 5))
+	assert.Equal(t, "Compared to baseline: exec duration -10.0%, ops/sec +10.0%\n", out.String())
+
+	out.Reset()
+	slower := &benchResult{
+		ExecDuration:        benchSummary{Mean: 110},
+		OperationsPerSecond: benchSummary{Mean: 910},
+	}
+	assert.True(t, slower.compare(&out, baseline, 5))
+	assert.Equal(t, "Compared to baseline: exec duration +10.0%, ops/sec -9.0%\n"+
+		"Regression above threshold of 5.0%\n", out.String())
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// callConvention describes how a compiled program calls functions. A call
+// pushes the return address, i.e. the address after the jump instruction, to
+// the memory and then jumps to the function. A return jumps to the pushed
+// return address.
+type callConvention struct {
+	// Window is the maximum number of instructions between pushing the return
+	// address and the jump to the function.
+	Window int
+	// AdjustRelBase indicates whether a call has to adjust the relative base
+	// (opcode 9) between pushing the return address and the jump.
+	AdjustRelBase bool
+	// RelativeReturn indicates whether a return has to read the jump target
+	// in relative mode, i.e. from a slot of the stack.
+	RelativeReturn bool
+}
+
+// callConventions are the known calling conventions by their name.
+var callConventions = map[string]callConvention{
+	"relbase": {
+		Window:         4,
+		AdjustRelBase:  true,
+		RelativeReturn: true,
+	},
+	"stack": {
+		Window:         4,
+		AdjustRelBase:  false,
+		RelativeReturn: true,
+	},
+	"loose": {
+		Window:         8,
+		AdjustRelBase:  false,
+		RelativeReturn: false,
+	},
+}
+
+// callConventionNames returns the sorted names of the known calling conventions.
+func callConventionNames() []string {
+	names := make([]string, 0, len(callConventions))
+	for name := range callConventions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// callFrame is a function call on the call stack.
+type callFrame struct {
+	// Function is the address of the called function.
+	Function int `json:"function"`
+	// CallerIP is the IP of the jump instruction that called the function.
+	CallerIP int `json:"caller_ip"`
+	// ReturnAddress is the address the function returns to.
+	ReturnAddress int `json:"return_address"`
+}
+
+// pushedValue is a value written to the memory, which might be a return address.
+type pushedValue struct {
+	Value int64
+	Step  int
+}
+
+// callStack reconstructs the call stack of a program heuristically by
+// recognising the call and return patterns of a callConvention.
+type callStack struct {
+	Convention callConvention
+	// Frames are the active function calls. The last frame is the innermost
+	// function.
+	Frames []callFrame
+	// Calls is the number of recognised calls.
+	Calls uint
+	// Returns is the number of recognised returns.
+	Returns uint
+	// pushes are the values written within the window of the convention.
+	pushes []pushedValue
+	// adjustStep is the step of the last relative base adjustment.
+	adjustStep int
+}
+
+func newCallStack(convention callConvention) *callStack {
+	return &callStack{
+		Convention: convention,
+		adjustStep: -1,
+	}
+}
+
+// write records the write of value by the current instruction.
+func (c *callStack) write(p *Program, value int64) {
+	// Forget values that have been pushed before the window
+	i := 0
+	for i < len(c.pushes) && p.Steps-c.pushes[i].Step > c.Convention.Window {
+		i++
+	}
+	c.pushes = append(c.pushes[i:], pushedValue{Value: value, Step: p.Steps})
+}
+
+// execute records the executed instruction at ip with the raw opcode value
+// before the execution, which differs from the memory at ip after a
+// self-modification. It recognises calls and returns, if the instruction has
+// jumped, and reports whether the call stack has changed.
+func (c *callStack) execute(p *Program, ip int, raw int64, op opcode) bool {
+	if op == 9 {
+		c.adjustStep = p.Steps
+		return false
+	}
+	if (op != 5 && op != 6) || p.MoveIP {
+		// Not a jump or not taken
+		return false
+	}
+
+	targetMode := NewModeList(raw, 2)[1]
+	return c.isReturn(p.IP, targetMode) || c.isCall(p, ip)
+}
+
+// isReturn pops the frames up to the one returning to target, if the jump to
+// target is a return.
+func (c *callStack) isReturn(target int, targetMode Mode) bool {
+	if c.Convention.RelativeReturn && targetMode != 2 {
+		return false
+	}
+	for i := len(c.Frames) - 1; i >= 0; i-- {
+		if c.Frames[i].ReturnAddress == target {
+			c.Frames = c.Frames[:i]
+			c.Returns++
+			return true
+		}
+	}
+	return false
+}
+
+// isCall pushes a new frame, if the jump at ip is a call.
+func (c *callStack) isCall(p *Program, ip int) bool {
+	// The jump instruction has two arguments
+	returnAddress := ip + 3
+	for i := len(c.pushes) - 1; i >= 0; i-- {
+		push := c.pushes[i]
+		if p.Steps-push.Step > c.Convention.Window {
+			break
+		}
+		if push.Value != int64(returnAddress) {
+			continue
+		}
+		if c.Convention.AdjustRelBase && c.adjustStep < push.Step {
+			continue
+		}
+		c.Frames = append(c.Frames, callFrame{
+			Function:      p.IP,
+			CallerIP:      ip,
+			ReturnAddress: returnAddress,
+		})
+		c.Calls++
+		c.pushes = c.pushes[:0]
+		return true
+	}
+	return false
+}
+
+// function returns the address of the current function, or -1 if the program
+// is in its main code.
+func (c *callStack) function() int {
+	if len(c.Frames) == 0 {
+		return -1
+	}
+	return c.Frames[len(c.Frames)-1].Function
+}
+
+// backtrace returns the call stack with the innermost function first, while
+// the program is at ip.
+func (c *callStack) backtrace(ip int) string {
+	var b strings.Builder
+	for i := len(c.Frames) - 1; i >= 0; i-- {
+		frame := c.Frames[i]
+		fmt.Fprintf(&b, "#%d IP %d in function %d (returns to %d)\n",
+			len(c.Frames)-1-i, ip, frame.Function, frame.ReturnAddress)
+		ip = frame.CallerIP
+	}
+	fmt.Fprintf(&b, "#%d IP %d in main\n", len(c.Frames), ip)
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// callProgram calls the function at address 12, which returns through the
+// return address pushed to the relative base.
+const callProgram = "109,100," + // Set relative base to 100
+	"21101,11,0,0," + // Push return address 11
+	"109,1," + // Adjust relative base
+	"1105,1,12," + // Call function at 12
+	"99," + // End
+	"109,-1," + // Restore relative base
+	"2105,1,0" // Return to pushed address
+
+func TestCallStack(t *testing.T) {
+	p := New(callProgram, 100)
+	p.CallStack = newCallStack(callConventions["relbase"])
+	p.Exec()
+	assert.Equal(t, uint(1), p.CallStack.Calls)
+	assert.Equal(t, uint(1), p.CallStack.Returns)
+	assert.Empty(t, p.CallStack.Frames)
+}
+
+func TestCallStack_Convention(t *testing.T) {
+	// The relative base is not adjusted between the push and the jump
+	p := New("21101,7,0,0,1105,1,8,99,2105,1,0", 0)
+	p.CallStack = newCallStack(callConventions["relbase"])
+	p.Exec()
+	assert.Equal(t, uint(0), p.CallStack.Calls)
+
+	p = New("21101,7,0,0,1105,1,8,99,2105,1,0", 0)
+	p.CallStack = newCallStack(callConventions["stack"])
+	p.Exec()
+	assert.Equal(t, uint(1), p.CallStack.Calls)
+	assert.Equal(t, uint(1), p.CallStack.Returns)
+}
+
+func TestCallStack_Backtrace(t *testing.T) {
+	c := newCallStack(callConventions["relbase"])
+	c.Frames = []callFrame{
+		{Function: 20, CallerIP: 8, ReturnAddress: 11},
+		{Function: 40, CallerIP: 25, ReturnAddress: 28},
+	}
+	assert.Equal(t, 40, c.function())
+	assert.Equal(t, "#0 IP 42 in function 40 (returns to 28)\n"+
+		"#1 IP 25 in function 20 (returns to 11)\n"+
+		"#2 IP 8 in main\n", c.backtrace(42))
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// checkpointer saves the state of a program to a file every Every executed
+// instructions. The file is replaced atomically, so that it always contains a
+// complete checkpoint.
+type checkpointer struct {
+	Filename string
+	Every    int
+	interval stepInterval
+	// Input are the sources the input is read from, or empty for stdin.
+	Input []inputSpec
+	// ASCII indicates whether the input and output are ASCII characters.
+	ASCII bool
+	// output is the file the output is written to, whose offset is saved. It is
+	// nil for stdout.
+	output *os.File
+	// Saved is the number of saved checkpoints.
+	Saved int
+}
+
+// newCheckpointer creates a checkpointer saving to filename every every
+// instructions.
+func newCheckpointer(filename string, every int) *checkpointer {
+	return &checkpointer{Filename: filename, Every: every}
+}
+
+// execute counts the execution of the instruction at p.IP and saves a
+// checkpoint before it, if one is due.
+func (c *checkpointer) execute(p *Program) {
+	if !c.interval.due(p.Steps, c.Every) {
+		return
+	}
+	if err := c.save(p); err != nil {
+		panic(err)
+	}
+}
+
+// save writes a checkpoint of the program to a temporary file and renames it
+// to Filename.
+func (c *checkpointer) save(p *Program) error {
+	// The output up to the checkpoint has to be written to get its offset
+	p.flushOutput()
+	cp := newCheckpoint(p)
+	cp.Every = c.Every
+	cp.Input = c.Input
+	cp.ASCII = c.ASCII
+	if c.output != nil {
+		cp.OutputFilename = c.output.Name()
+		offset, err := c.output.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		cp.OutputOffset = offset
+	}
+
+	tmpFilename := c.Filename + ".tmp"
+	file, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	err = cp.write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	c.Saved++
+	return os.Rename(tmpFilename, c.Filename)
+}
+
+// checkpoint is the saved state of a program, from which the execution is
+// resumed.
+type checkpoint struct {
+	Version  string `json:"version"`
+	IP       int    `json:"ip"`
+	RelBase  int64  `json:"rel_base"`
+	Finish   bool   `json:"finish"`
+	Steps    int    `json:"steps"`
+	CodeLen  int    `json:"code_len"`
+	Memory   ints   `json:"memory"`
+	Optimize bool   `json:"optimize"`
+	// Inputs is the number of input values read before the checkpoint, which
+	// are skipped when resuming.
+	Inputs  int         `json:"inputs"`
+	Outputs int         `json:"outputs"`
+	Input   []inputSpec `json:"input,omitempty"`
+	EOF     EOFPolicy   `json:"eof"`
+	ASCII   bool        `json:"ascii,omitempty"`
+	// OutputMidLine indicates whether the ASCII output has ended within a
+	// line, so that a number is printed on a new line after resuming.
+	OutputMidLine  bool   `json:"output_mid_line,omitempty"`
+	OutputFilename string `json:"output_file,omitempty"`
+	// OutputOffset is the size of the output file at the checkpoint, to which
+	// it is truncated when resuming.
+	OutputOffset int64            `json:"output_offset,omitempty"`
+	Every        int              `json:"every"`
+	Stats        *checkpointStats `json:"stats,omitempty"`
+}
+
+// checkpointStats are the stats of a checkpoint. Unlike stats.MarshalJSON, the
+// opcodes and modes are saved as numbers, so that they can be read again.
+type checkpointStats struct {
+	ExecDuration           time.Duration   `json:"exec_duration_ns"`
+	Operations             map[opcode]uint `json:"operations"`
+	MemoryAccesses         map[string]uint `json:"memory_accesses"`
+	MemoryAccessesByMode   map[Mode]uint   `json:"memory_accesses_by_mode"`
+	MemoryAccessesByOpcode map[opcode]uint `json:"memory_accesses_by_opcode"`
+	MemoryAccessesByRegion map[string]uint `json:"memory_accesses_by_region"`
+	MemoryGrowths          uint            `json:"memory_growths"`
+	PeakMemory             int             `json:"peak_memory"`
+	Superinstructions      map[string]uint `json:"superinstructions"`
+	InitialMemory          int             `json:"initial_memory"`
+}
+
+// newCheckpoint creates a checkpoint of the program. The stats are saved, if
+// they have been created by NewStats, including the operations counted by the
+// fast dispatch loop so far.
+func newCheckpoint(p *Program) *checkpoint {
+	cp := &checkpoint{
+		Version:  version,
+		IP:       p.IP,
+		RelBase:  p.RelBase,
+		Finish:   p.Finish,
+		Steps:    p.Steps,
+		CodeLen:  p.CodeLen,
+		Memory:   p.Ints,
+		Optimize: p.Optimize,
+		Inputs:   p.Inputs,
+		Outputs:  p.Outputs,
+		EOF:      p.EOF,
+	}
+	if out, ok := p.OutputSink.(*asciiOutput); ok {
+		cp.OutputMidLine = !out.lineStart
+	}
+	if p.Stats.Operations == nil {
+		return cp
+	}
+	s := &p.Stats
+	cs := &checkpointStats{
+		ExecDuration:           s.resumedDuration + time.Since(s.StartTime),
+		Operations:             map[opcode]uint{},
+		MemoryAccesses:         s.MemoryAccesses,
+		MemoryAccessesByMode:   s.MemoryAccessesByMode,
+		MemoryAccessesByOpcode: s.MemoryAccessesByOpcode,
+		MemoryAccessesByRegion: s.MemoryAccessesByRegion,
+		MemoryGrowths:          s.MemoryGrowths,
+		PeakMemory:             s.PeakMemory,
+		Superinstructions:      map[string]uint{},
+		InitialMemory:          s.initialMemory,
+	}
+	for op, count := range s.Operations {
+		cs.Operations[op] = count
+	}
+	for op, count := range p.opCounts {
+		if count > 0 {
+			cs.Operations[opcode(op)] += count
+		}
+	}
+	for name, count := range s.Superinstructions {
+		cs.Superinstructions[name] = count
+	}
+	for i, count := range p.superCounts {
+		if count > 0 {
+			cs.Superinstructions[superinstructionNames[i]] += count
+		}
+	}
+	if len(p.Ints) > cs.PeakMemory {
+		cs.PeakMemory = len(p.Ints)
+	}
+	cp.Stats = cs
+	return cp
+}
+
+// write writes the checkpoint as JSON to w.
+func (cp *checkpoint) write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(cp)
+}
+
+// readCheckpoint reads a checkpoint written by checkpoint.write.
+func readCheckpoint(r io.Reader) (*checkpoint, error) {
+	cp := &checkpoint{}
+	if err := json.NewDecoder(bufio.NewReader(r)).Decode(cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Program restores the program from the checkpoint. The input values read
+// before the checkpoint have to be skipped by skipInputs.
+func (cp *checkpoint) Program() *Program {
+	memory := make(ints, len(cp.Memory))
+	copy(memory, cp.Memory)
+	p := &Program{
+		Ints:         memory,
+		CodeLen:      cp.CodeLen,
+		IP:           cp.IP,
+		RelBase:      cp.RelBase,
+		Finish:       cp.Finish,
+		Steps:        cp.Steps,
+		Inputs:       cp.Inputs,
+		Outputs:      cp.Outputs,
+		Optimize:     cp.Optimize,
+		InputReader:  os.Stdin,
+		EOF:          cp.EOF,
+		DebugWriter:  os.Stderr,
+		OutputWriter: os.Stdout,
+	}
+	if cs := cp.Stats; cs != nil {
+		p.Stats = NewStats()
+		p.Stats.resumedDuration = cs.ExecDuration
+		p.Stats.MemoryGrowths = cs.MemoryGrowths
+		p.Stats.PeakMemory = cs.PeakMemory
+		p.Stats.initialMemory = cs.InitialMemory
+		copyCounts := func(dst map[string]uint, src map[string]uint) {
+			for key, count := range src {
+				dst[key] = count
+			}
+		}
+		for op, count := range cs.Operations {
+			p.Stats.Operations[op] = count
+		}
+		for op, count := range cs.MemoryAccessesByOpcode {
+			p.Stats.MemoryAccessesByOpcode[op] = count
+		}
+		for mode, count := range cs.MemoryAccessesByMode {
+			p.Stats.MemoryAccessesByMode[mode] = count
+		}
+		copyCounts(p.Stats.MemoryAccesses, cs.MemoryAccesses)
+		copyCounts(p.Stats.MemoryAccessesByRegion, cs.MemoryAccessesByRegion)
+		copyCounts(p.Stats.Superinstructions, cs.Superinstructions)
+	}
+	return p
+}
+
+// skipInputs reads n input values from in, which have been read before a
+// checkpoint.
+func skipInputs(in InputSource, n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := in.ReadInput(); err != nil {
+			return fmt.Errorf("skipping input value %d of %d: %w", i+1, n, err)
+		}
+	}
+	return nil
+}
+
+// resumeCommand resumes the execution of a program from a checkpoint.
+func resumeCommand(args []string) {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s resume <flags> <state>\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	var input []inputSpec
+	fs.Var(inputFlag{specs: &input}, "input", "File to read input values from instead of the input of the checkpoint, "+
+		"or '-' for stdin. Can be repeated and combined with -in. The values read before the checkpoint are skipped")
+	fs.Var(inputFlag{specs: &input, values: true}, "in", "Comma separated input values instead of the input of the "+
+		"checkpoint. Can be repeated and combined with -input")
+	eof := fs.String("eof", "", "What happens when reading beyond the end of the input (error, halt, block, or an int). "+
+		"Defaults to the policy of the checkpoint")
+	outputFilename := fs.String("output", "", "File to print output values to instead of the output file of the checkpoint")
+	every := fs.Int("checkpoint-every", -1, "Number of instructions between two checkpoints saved to the state file, "+
+		"or 0 to save none. Defaults to the interval of the checkpoint")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	cp, err := readCheckpoint(file)
+	file.Close()
+	if err != nil {
+		panic(err)
+	}
+	p := cp.Program()
+
+	if *eof != "" {
+		if p.EOF, err = ParseEOFPolicy(*eof); err != nil {
+			panic(err)
+		}
+	}
+	if len(input) == 0 {
+		input = cp.Input
+	}
+	in, inputFiles, err := openInputs(input, cp.ASCII, p.EOF.Action == EOFBlock, p.DebugWriter)
+	if err != nil {
+		panic(err)
+	}
+	defer closeFiles(inputFiles)
+	p.InputSource = in
+	p.InputReader = nil
+	if err := skipInputs(in, cp.Inputs); err != nil {
+		panic(err)
+	}
+
+	var output *os.File
+	if *outputFilename == "" && cp.OutputFilename != "" {
+		// Continue the output file after the output written before the
+		// checkpoint, and remove the output written after it
+		output, err = os.OpenFile(cp.OutputFilename, os.O_CREATE|os.O_WRONLY, 0664)
+		if err == nil {
+			err = output.Truncate(cp.OutputOffset)
+		}
+		if err == nil {
+			_, err = output.Seek(cp.OutputOffset, io.SeekStart)
+		}
+	} else if *outputFilename != "" {
+		output, err = os.OpenFile(*outputFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	}
+	if err != nil {
+		panic(err)
+	}
+	if output != nil {
+		defer output.Close()
+		p.OutputWriter = bufio.NewWriterSize(output, outputBufferSize)
+	} else {
+		p.OutputWriter = bufio.NewWriterSize(os.Stdout, outputBufferSize)
+	}
+	if cp.ASCII {
+		out := NewASCIIOutput(p.OutputWriter).(*asciiOutput)
+		// A new output file starts with a new line
+		out.lineStart = !cp.OutputMidLine || *outputFilename != ""
+		p.OutputSink = out
+	}
+
+	if *every < 0 {
+		*every = cp.Every
+	}
+	if *every > 0 {
+		p.Checkpoint = newCheckpointer(fs.Arg(0), *every)
+		p.Checkpoint.Input = input
+		p.Checkpoint.ASCII = cp.ASCII
+		p.Checkpoint.output = output
+	}
+	p.Exec()
+	if cp.Stats != nil {
+		writeStats(&p.Stats)
+	}
+}
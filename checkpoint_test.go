@@ -0,0 +1,144 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countdown outputs the values from the first input down to 1, followed by the
+// second input.
+const countdown = "3,100,4,100,1001,100,-1,100,1005,100,2,3,101,4,101,99"
+
+// resumeCheckpoint reads the checkpoint in filename and resumes the program
+// with the input, returning the program and its output.
+func resumeCheckpoint(t *testing.T, filename string, input string) (*checkpoint, *Program, string) {
+	file, err := os.Open(filename)
+	assert.NoError(t, err)
+	defer file.Close()
+	cp, err := readCheckpoint(file)
+	assert.NoError(t, err)
+
+	p := cp.Program()
+	p.InputReader = strings.NewReader(input)
+	assert.NoError(t, skipInputs(NewNumberInput(p.InputReader), cp.Inputs))
+	out := &strings.Builder{}
+	p.OutputWriter = out
+	p.Exec()
+	return cp, p, out.String()
+}
+
+func TestCheckpoint_Resume(t *testing.T) {
+	for _, optimize := range []bool{false, true} {
+		filename := filepath.Join(t.TempDir(), "countdown.state")
+		p := New(countdown, 0)
+		p.Optimize = optimize
+		p.Stats = NewStats()
+		p.InputReader = strings.NewReader("5 42")
+		out := &strings.Builder{}
+		p.OutputWriter = out
+		p.Checkpoint = newCheckpointer(filename, 7)
+		p.Exec()
+		assert.Equal(t, "5\n4\n3\n2\n1\n42\n", out.String())
+		assert.Equal(t, 2, p.Checkpoint.Saved)
+
+		cp, resumed, resumedOut := resumeCheckpoint(t, filename, "5 42")
+		assert.Equal(t, 13, cp.Steps)
+		assert.Equal(t, 1, cp.Inputs)
+		assert.Equal(t, optimize, cp.Optimize)
+		assert.Equal(t, "1\n42\n", resumedOut)
+		assert.Equal(t, p.Ints, resumed.Ints)
+		assert.Equal(t, p.Steps, resumed.Steps)
+		assert.Equal(t, p.Inputs, resumed.Inputs)
+		assert.Equal(t, p.Stats.Operations, resumed.Stats.Operations)
+		assert.Equal(t, p.Stats.MemoryAccesses, resumed.Stats.MemoryAccesses)
+		assert.Equal(t, p.Stats.MemoryAccessesByMode, resumed.Stats.MemoryAccessesByMode)
+		assert.Equal(t, p.Stats.MemoryAccessesByRegion, resumed.Stats.MemoryAccessesByRegion)
+		assert.Equal(t, p.Stats.Superinstructions, resumed.Stats.Superinstructions)
+		assert.Equal(t, p.Stats.PeakMemory, resumed.Stats.PeakMemory)
+		assert.NoFileExists(t, filename+".tmp")
+	}
+}
+
+func TestCheckpoint_OutputOffset(t *testing.T) {
+	dir := t.TempDir()
+	output, err := os.OpenFile(filepath.Join(dir, "out"), os.O_CREATE|os.O_WRONLY, 0664)
+	assert.NoError(t, err)
+	defer output.Close()
+
+	p := New(countdown, 0)
+	p.InputReader = strings.NewReader("5 42")
+	p.OutputWriter = output
+	p.Checkpoint = newCheckpointer(filepath.Join(dir, "state"), 4)
+	p.Checkpoint.output = output
+	p.Exec()
+
+	state, err := ioutil.ReadFile(filepath.Join(dir, "state"))
+	assert.NoError(t, err)
+	cp, err := readCheckpoint(strings.NewReader(string(state)))
+	assert.NoError(t, err)
+	assert.Equal(t, output.Name(), cp.OutputFilename)
+	// The outputs 5 to 1 have been written before the last checkpoint
+	assert.Equal(t, int64(len("5\n4\n3\n2\n1\n")), cp.OutputOffset)
+}
+
+func TestSkipInputs(t *testing.T) {
+	r := strings.NewReader("1 2 3")
+	assert.NoError(t, skipInputs(NewNumberInput(r), 2))
+	rest, _ := ioutil.ReadAll(r)
+	assert.Equal(t, " 3", string(rest))
+
+	assert.EqualError(t, skipInputs(NewNumberInput(strings.NewReader("1")), 2), "skipping input value 2 of 2: EOF")
+	assert.EqualError(t, skipInputs(NewNumberInput(strings.NewReader("1 \n\n")), 2), "skipping input value 2 of 2: EOF")
+
+	ascii := NewASCIIInput(strings.NewReader("ab\ncd"))
+	assert.NoError(t, skipInputs(ascii, 4))
+	value, _ := ascii.ReadInput()
+	assert.Equal(t, int64('d'), value)
+}
+
+func TestCheckpoint_Input(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "countdown.state")
+	p := New(countdown, 0)
+	p.InputSource = NewValuesInput(5, 42)
+	p.EOF = EOFPolicy{Action: EOFHalt}
+	p.OutputWriter = &strings.Builder{}
+	p.Checkpoint = newCheckpointer(filename, 7)
+	p.Checkpoint.Input = []inputSpec{{Values: ints{5, 42}}}
+	p.Exec()
+
+	file, err := os.Open(filename)
+	assert.NoError(t, err)
+	defer file.Close()
+	cp, err := readCheckpoint(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []inputSpec{{Values: ints{5, 42}}}, cp.Input)
+	assert.Equal(t, EOFPolicy{Action: EOFHalt}, cp.EOF)
+
+	resumed := cp.Program()
+	assert.Equal(t, EOFPolicy{Action: EOFHalt}, resumed.EOF)
+	in, files, err := openInputs(cp.Input, cp.ASCII, false, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+	assert.NoError(t, skipInputs(in, cp.Inputs))
+	resumed.InputSource = in
+	out := &strings.Builder{}
+	resumed.OutputWriter = out
+	resumed.Exec()
+	assert.Equal(t, "1\n42\n", out.String())
+}
+
+func TestCheckpoint_OutputMidLine(t *testing.T) {
+	p := New("104,97,99", 0)
+	p.OutputSink = NewASCIIOutput(&strings.Builder{})
+	p.Exec()
+	assert.True(t, newCheckpoint(p).OutputMidLine)
+
+	p = New("104,10,99", 0)
+	p.OutputSink = NewASCIIOutput(&strings.Builder{})
+	p.Exec()
+	assert.False(t, newCheckpoint(p).OutputMidLine)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coverageHeader is the first line of a coverage file.
+const coverageHeader = "intcode coverage v1"
+
+// coverage records the executed instruction addresses and the outcomes of the
+// conditional jumps of one or more runs of a program.
+type coverage struct {
+	// Program is a hash of the program code, to prevent merging the coverage
+	// of different programs.
+	Program string
+	// Hits are the number of executions per instruction address.
+	Hits map[int]uint64
+	// Taken are the number of taken jumps per address of opcodes 5 and 6.
+	Taken map[int]uint64
+	// NotTaken are the number of not taken jumps per address of opcodes 5 and 6.
+	NotTaken map[int]uint64
+}
+
+// newCoverage creates an empty coverage for the program in its initial state.
+func newCoverage(p *Program) *coverage {
+	return &coverage{
+		Program:  programHash(p.Ints[:p.CodeLen]),
+		Hits:     map[int]uint64{},
+		Taken:    map[int]uint64{},
+		NotTaken: map[int]uint64{},
+	}
+}
+
+// programHash returns a hash of the code.
+func programHash(code ints) string {
+	h := fnv.New64a()
+	io.WriteString(h, code.String())
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// execute records the execution of the instruction at ip.
+func (c *coverage) execute(ip int) {
+	c.Hits[ip]++
+}
+
+// branch records the outcome of the conditional jump at ip.
+func (c *coverage) branch(ip int, taken bool) {
+	if taken {
+		c.Taken[ip]++
+	} else {
+		c.NotTaken[ip]++
+	}
+}
+
+// merge adds the coverage of other, which has to belong to the same program.
+func (c *coverage) merge(other *coverage) error {
+	if c.Program != other.Program {
+		return fmt.Errorf("coverage of program %s cannot be merged with program %s", other.Program, c.Program)
+	}
+	for address, hits := range other.Hits {
+		c.Hits[address] += hits
+	}
+	for address, taken := range other.Taken {
+		c.Taken[address] += taken
+	}
+	for address, notTaken := range other.NotTaken {
+		c.NotTaken[address] += notTaken
+	}
+	return nil
+}
+
+// write writes the coverage to w. After the header and the program hash, each
+// line consists of an address, its hits and the taken and not taken jumps.
+func (c *coverage) write(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintln(buf, coverageHeader)
+	fmt.Fprintln(buf, "program", c.Program)
+	for _, address := range sortedKeys(c.Hits) {
+		fmt.Fprintln(buf, address, c.Hits[address], c.Taken[address], c.NotTaken[address])
+	}
+	return buf.Flush()
+}
+
+// readCoverage reads a coverage written by coverage.write.
+func readCoverage(r io.Reader) (*coverage, error) {
+	c := &coverage{
+		Hits:     map[int]uint64{},
+		Taken:    map[int]uint64{},
+		NotTaken: map[int]uint64{},
+	}
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || scanner.Text() != coverageHeader {
+		return nil, fmt.Errorf("missing header %q", coverageHeader)
+	}
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "program ") {
+		return nil, fmt.Errorf("missing program hash")
+	}
+	c.Program = strings.TrimPrefix(scanner.Text(), "program ")
+
+	for lineNum := 3; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected <address> <hits> <taken> <not taken>", lineNum)
+		}
+		address, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		var counts [3]uint64
+		for i := range counts {
+			if counts[i], err = strconv.ParseUint(fields[i+1], 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+		}
+		c.Hits[address] = counts[0]
+		if counts[1] > 0 {
+			c.Taken[address] = counts[1]
+		}
+		if counts[2] > 0 {
+			c.NotTaken[address] = counts[2]
+		}
+	}
+	return c, scanner.Err()
+}
+
+// sortedKeys returns the sorted keys of m.
+func sortedKeys(m map[int]uint64) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// coverProgram counts position 12 up to 3 in a loop.
+const coverProgram = "1001,12,1,12,1007,12,3,13,1005,13,0,99"
+
+func TestCoverage(t *testing.T) {
+	p := New(coverProgram, 2)
+	p.Cover = newCoverage(p)
+	p.Exec()
+	assert.Equal(t, map[int]uint64{0: 3, 4: 3, 8: 3, 11: 1}, p.Cover.Hits)
+	assert.Equal(t, map[int]uint64{8: 2}, p.Cover.Taken)
+	assert.Equal(t, map[int]uint64{8: 1}, p.Cover.NotTaken)
+}
+
+func TestCoverage_WriteReadMerge(t *testing.T) {
+	p := New(coverProgram, 2)
+	c := newCoverage(p)
+	p.Cover = c
+	p.Exec()
+
+	var buf bytes.Buffer
+	assert.NoError(t, c.write(&buf))
+	read, err := readCoverage(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, c, read)
+
+	assert.NoError(t, c.merge(read))
+	assert.Equal(t, uint64(6), c.Hits[0])
+	assert.Equal(t, uint64(4), c.Taken[8])
+
+	other := newCoverage(New("99", 0))
+	assert.Error(t, c.merge(other))
+}
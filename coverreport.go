@@ -0,0 +1,301 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Coverage states of a line of a coverage report.
+const (
+	coverNone    = "none"
+	coverHit     = "hit"
+	coverMiss    = "miss"
+	coverPartial = "partial"
+)
+
+// coverageLine is a line of a coverage report, which is either a line of the
+// source or a single instruction.
+type coverageLine struct {
+	// Number is the line number of the source, or the address of the
+	// instruction.
+	Number int
+	Text   string
+	// Instructions is the number of instructions starting on the line.
+	Instructions int
+	// Hits is the maximum number of executions of the instructions on the line.
+	Hits uint64
+	// Missed is the number of instructions on the line, that have not been
+	// executed.
+	Missed int
+	// Branches are the outcomes of the conditional jumps on the line.
+	Branches string
+	// State is one of coverNone, coverHit, coverMiss and coverPartial.
+	State string
+}
+
+// coverageReport is the coverage of a program annotated on its source lines or
+// on its instructions.
+type coverageReport struct {
+	Lines []coverageLine
+	// Instructions is the number of instructions of the program.
+	Instructions int
+	// HitInstructions is the number of executed instructions.
+	HitInstructions int
+	// BranchOutcomes is the number of possible outcomes of the conditional jumps.
+	BranchOutcomes int
+	// HitBranchOutcomes is the number of outcomes that have occurred.
+	HitBranchOutcomes int
+}
+
+// newCoverageReport creates a report of the coverage of the program parsed
+// from source. The instructions are found by a linear sweep over the code and
+// the executed addresses. If every int of the code can be mapped to a line of
+// the source, the report is annotated on the source lines.
+func newCoverageReport(c *coverage, source string) *coverageReport {
+	p := New(source, 0)
+	code := p.Ints[:p.CodeLen]
+	lineOf := sourceLines(source)
+	annotateSource := len(lineOf) == len(code)
+
+	r := &coverageReport{}
+	if annotateSource {
+		for i, text := range strings.Split(source, "\n") {
+			r.Lines = append(r.Lines, coverageLine{Number: i + 1, Text: text})
+		}
+	}
+
+	for address := 0; address < len(code); {
+		text, size := disassembleInstruction(code, address)
+		hits := c.Hits[address]
+		if strings.HasPrefix(text, "data ") && hits == 0 {
+			address++
+			continue
+		}
+
+		var line *coverageLine
+		if annotateSource {
+			line = &r.Lines[lineOf[address]-1]
+		} else {
+			r.Lines = append(r.Lines, coverageLine{
+				Number: address,
+				Text:   fmt.Sprintf("%-24s %s", code[address:address+size].String(), text),
+			})
+			line = &r.Lines[len(r.Lines)-1]
+		}
+		r.addInstruction(line, c, address, newOpcode(code[address]))
+		address += size
+	}
+
+	for i := range r.Lines {
+		r.Lines[i].State = lineState(&r.Lines[i])
+	}
+	return r
+}
+
+// addInstruction adds the instruction at address with opcode op to line.
+func (r *coverageReport) addInstruction(line *coverageLine, c *coverage, address int, op opcode) {
+	hits := c.Hits[address]
+	r.Instructions++
+	line.Instructions++
+	if hits > 0 {
+		r.HitInstructions++
+	} else {
+		line.Missed++
+	}
+	if hits > line.Hits {
+		line.Hits = hits
+	}
+	if op != 5 && op != 6 {
+		return
+	}
+
+	taken, notTaken := c.Taken[address], c.NotTaken[address]
+	r.BranchOutcomes += 2
+	for _, count := range []uint64{taken, notTaken} {
+		if count > 0 {
+			r.HitBranchOutcomes++
+		}
+	}
+	if line.Branches != "" {
+		line.Branches += "; "
+	}
+	line.Branches += fmt.Sprintf("%d: taken %d, not taken %d", address, taken, notTaken)
+}
+
+// lineState returns the coverage state of the line. A line is partially
+// covered, if not all of its instructions have been executed or not all
+// outcomes of its conditional jumps have occurred.
+func lineState(line *coverageLine) string {
+	if line.Instructions == 0 {
+		return coverNone
+	}
+	if line.Hits == 0 {
+		return coverMiss
+	}
+	if line.Missed > 0 || strings.Contains(line.Branches, "taken 0") {
+		return coverPartial
+	}
+	return coverHit
+}
+
+// sourceLines returns the line number of each int of the source, or nil if
+// the source cannot be parsed.
+func sourceLines(source string) []int {
+	ps := newParser(strings.NewReader(source))
+	ps.recordLines = true
+	if _, err := ps.parse(); err != nil {
+		return nil
+	}
+	return ps.Lines
+}
+
+// percentage returns part of total in percent, or 100 if total is zero.
+func percentage(part int, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(part) / float64(total) * 100
+}
+
+// Summary returns the instruction and branch coverage.
+func (r *coverageReport) Summary() string {
+	return fmt.Sprintf("Instructions: %d of %d executed (%.1f%%), branch outcomes: %d of %d (%.1f%%)",
+		r.HitInstructions, r.Instructions, percentage(r.HitInstructions, r.Instructions),
+		r.HitBranchOutcomes, r.BranchOutcomes, percentage(r.HitBranchOutcomes, r.BranchOutcomes))
+}
+
+// writeText writes the report as a text listing to w. Lines with instructions
+// show their hits, and missed lines are marked with "!".
+func (r *coverageReport) writeText(w io.Writer) {
+	for _, line := range r.Lines {
+		hits := ""
+		if line.Instructions > 0 {
+			hits = fmt.Sprint(line.Hits)
+		}
+		marker := " "
+		if line.State == coverMiss || line.State == coverPartial {
+			marker = "!"
+		}
+		text := line.Text
+		if line.Branches != "" {
+			text += "  [" + line.Branches + "]"
+		}
+		fmt.Fprintf(w, "%s %10s %6d | %s\n", marker, hits, line.Number, text)
+	}
+	fmt.Fprintln(w, r.Summary())
+}
+
+var coverageHTMLTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: monospace; }
+td { padding: 0 0.5em; white-space: pre; }
+td.hits, td.number { text-align: right; color: #666; }
+tr.hit { background: #d8f5d8; }
+tr.miss { background: #f8d0d0; }
+tr.partial { background: #f8f0c0; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Report.Summary}}</p>
+<table>
+{{range .Report.Lines}}<tr class="{{.State}}" title="{{.Branches}}"><td class="hits">{{if .Instructions}}{{.Hits}}{{end}}</td><td class="number">{{.Number}}</td><td>{{.Text}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// writeHTML writes the report as a HTML listing to w, in which the lines are
+// colored by their coverage state.
+func (r *coverageReport) writeHTML(w io.Writer, title string) error {
+	return coverageHTMLTemplate.Execute(w, struct {
+		Title  string
+		Report *coverageReport
+	}{title, r})
+}
+
+// coverCommand shows the coverage file of a program as a text or HTML listing.
+func coverCommand(args []string) {
+	fs := flag.NewFlagSet("cover", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s cover <flags> <program> <coverage>\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	htmlFilename := fs.String("html", "", "File to write a HTML listing to instead of the text listing")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	source, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	c := openCoverage(fs.Arg(1))
+	if c == nil {
+		panic("Coverage file " + fs.Arg(1) + " does not exist")
+	}
+	if hash := programHash(New(string(source), 0).Ints); hash != c.Program {
+		panic(fmt.Sprintf("Coverage of program %s does not belong to %s (%s)", c.Program, fs.Arg(0), hash))
+	}
+	report := newCoverageReport(c, string(source))
+
+	if *htmlFilename == "" {
+		report.writeText(os.Stdout)
+		return
+	}
+	file, err := os.OpenFile(*htmlFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	if err := report.writeHTML(file, "Coverage of "+fs.Arg(0)); err != nil {
+		panic(err)
+	}
+}
+
+// openCoverage reads the coverage file filename. It returns nil, if the file
+// does not exist.
+func openCoverage(filename string) *coverage {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	c, err := readCoverage(file)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", filename, err))
+	}
+	return c
+}
+
+// saveCoverage merges the coverage into the coverage file filename and writes
+// it back.
+func saveCoverage(filename string, c *coverage) {
+	if existing := openCoverage(filename); existing != nil {
+		if err := c.merge(existing); err != nil {
+			panic(err)
+		}
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	if err := c.write(file); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceLines(t *testing.T) {
+	assert.Equal(t, []int{2, 2, 4, 4, 4}, sourceLines("# Comment\n1, 2\n\n3 4,5 # Comment"))
+}
+
+func TestCoverageReport(t *testing.T) {
+	source := "# Loop\n1001,20,1,20\n1007,20,3,21\n1005,21,0\n99\n4,20"
+	p := New(source, 10)
+	p.Cover = newCoverage(p)
+	p.Exec()
+
+	r := newCoverageReport(p.Cover, source)
+	assert.Equal(t, 5, r.Instructions)
+	assert.Equal(t, 4, r.HitInstructions)
+	assert.Equal(t, 2, r.BranchOutcomes)
+	assert.Equal(t, 2, r.HitBranchOutcomes)
+
+	var out bytes.Buffer
+	r.writeText(&out)
+	assert.Equal(t, "                  1 | # Loop\n"+
+		"           3      2 | 1001,20,1,20\n"+
+		"           3      3 | 1007,20,3,21\n"+
+		"           3      4 | 1005,21,0  [8: taken 2, not taken 1]\n"+
+		"           1      5 | 99\n"+
+		"!          0      6 | 4,20\n"+
+		"Instructions: 4 of 5 executed (80.0%), branch outcomes: 2 of 2 (100.0%)\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, r.writeHTML(&out, "Coverage"))
+	assert.Contains(t, out.String(), `<tr class="miss" title=""><td class="hits">0</td><td class="number">6</td><td>4,20</td></tr>`)
+}
+
+func TestCoverCommand_Patched(t *testing.T) {
+	dir := t.TempDir()
+	programFilename := filepath.Join(dir, "p.ic")
+	assert.NoError(t, ioutil.WriteFile(programFilename, []byte(coverProgram), 0664))
+	out, err := os.Create(filepath.Join(dir, "out"))
+	assert.NoError(t, err)
+	defer out.Close()
+
+	// Like intcode -set 6=5 -cover cov p.ic, counting up to 5
+	defer func(file *os.File, cover string, patches []MemoryPatch) {
+		outputFile, coverFilename, memoryPatches = file, cover, patches
+	}(outputFile, coverFilename, memoryPatches)
+	outputFile = out
+	coverFilename = filepath.Join(dir, "cov")
+	memoryPatches = []MemoryPatch{{Address: 6, Values: ints{5}}}
+	runProgram(openProgram(programFilename))
+
+	htmlFilename := filepath.Join(dir, "cov.html")
+	assert.NotPanics(t, func() {
+		coverCommand([]string{"-html", htmlFilename, programFilename, coverFilename})
+	})
+	assert.FileExists(t, htmlFilename)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// crashRecorder records the last executed instructions and the outputs of a
+// program, which are written to a core dump if the program crashes.
+type crashRecorder struct {
+	// history is a ring buffer of the last executed instructions.
+	history []traceStep
+	// next is the index in history of the next instruction.
+	next int
+	// full indicates whether the ring buffer has been filled once.
+	full bool
+	// Outputs are all values that the program has output so far.
+	Outputs ints
+}
+
+// newCrashRecorder creates a crash recorder, that keeps the last historyLen
+// executed instructions.
+func newCrashRecorder(historyLen int) *crashRecorder {
+	return &crashRecorder{history: make([]traceStep, historyLen)}
+}
+
+// execute records the instruction at Program.IP before its execution.
+func (c *crashRecorder) execute(p *Program, op opcode) {
+	if len(c.history) == 0 {
+		return
+	}
+	end := p.IP + 1 + opcodes[op].ArgNum
+	if end > len(p.Ints) {
+		end = len(p.Ints)
+	}
+	raw := make(ints, end-p.IP)
+	copy(raw, p.Ints[p.IP:end])
+	c.history[c.next] = traceStep{Step: p.Steps, IP: p.IP, RelBase: p.RelBase, Raw: raw}
+	c.next = (c.next + 1) % len(c.history)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+// output records an output value.
+func (c *crashRecorder) output(value int64) {
+	c.Outputs = append(c.Outputs, value)
+}
+
+// History returns the recorded instructions, the oldest first.
+func (c *crashRecorder) History() []traceStep {
+	if !c.full {
+		return append([]traceStep{}, c.history[:c.next]...)
+	}
+	return append(append([]traceStep{}, c.history[c.next:]...), c.history[:c.next]...)
+}
+
+// coreDump is the state of a crashed program.
+type coreDump struct {
+	Version      string          `json:"version"`
+	Error        string          `json:"error"`
+	IP           int             `json:"ip"`
+	RelBase      int64           `json:"rel_base"`
+	Steps        int             `json:"steps"`
+	CodeLen      int             `json:"code_len"`
+	Memory       ints            `json:"memory"`
+	History      []traceStep     `json:"history"`
+	PendingInput string          `json:"pending_input"`
+	Outputs      ints            `json:"outputs"`
+	CallStack    []callFrame     `json:"call_stack,omitempty"`
+	Stats        json.RawMessage `json:"stats,omitempty"`
+}
+
+// newCoreDump creates a core dump of the program, which has crashed with err.
+// The pending input is read ahead from Program.InputSource, or from
+// Program.InputReader without an input source, as far as it is available
+// without waiting for more input.
+func newCoreDump(p *Program, err error) *coreDump {
+	core := &coreDump{
+		Version: version,
+		Error:   err.Error(),
+		IP:      p.IP,
+		RelBase: p.RelBase,
+		Steps:   p.Steps,
+		CodeLen: p.CodeLen,
+		Memory:  p.Ints,
+	}
+	if p.Crash != nil {
+		core.History = p.Crash.History()
+		core.Outputs = p.Crash.Outputs
+	}
+	if p.InputSource != nil {
+		// The values are written as numbers, which are read on resuming
+		values, _ := p.InputSource.Pending()
+		var pending []byte
+		for _, value := range values {
+			pending = append(strconv.AppendInt(pending, value, 10), '\n')
+		}
+		core.PendingInput = string(pending)
+	} else if canReadAll(p.InputReader) {
+		pending, _ := ioutil.ReadAll(p.InputReader)
+		core.PendingInput = string(pending)
+	}
+	if p.CallStack != nil {
+		core.CallStack = p.CallStack.Frames
+	}
+	if p.Stats.Activated {
+		core.Stats, _ = json.Marshal(&p.Stats)
+	}
+	return core
+}
+
+// write writes the core dump as JSON to w.
+func (core *coreDump) write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(core)
+}
+
+// readCoreDump reads a core dump written by coreDump.write.
+func readCoreDump(r io.Reader) (*coreDump, error) {
+	core := &coreDump{}
+	if err := json.NewDecoder(r).Decode(core); err != nil {
+		return nil, err
+	}
+	return core, nil
+}
+
+// Program restores the program from the core dump, so that the execution can
+// be resumed at the crashed instruction.
+func (core *coreDump) Program() *Program {
+	memory := make(ints, len(core.Memory))
+	copy(memory, core.Memory)
+	return &Program{
+		Ints:         memory,
+		CodeLen:      core.CodeLen,
+		IP:           core.IP,
+		RelBase:      core.RelBase,
+		Steps:        core.Steps,
+		InputReader:  os.Stdin,
+		DebugWriter:  os.Stderr,
+		OutputWriter: os.Stdout,
+	}
+}
+
+// execRecover executes the program and recovers from a crash. It returns the
+// reason of the crash, or nil if the program has finished normally.
+func (p *Program) execRecover() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	p.Exec()
+	return nil
+}
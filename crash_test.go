@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCrashRecorder_History(t *testing.T) {
+	c := newCrashRecorder(2)
+	assert.Empty(t, c.History())
+	p := New("1101,1,2,0,1101,1,2,0,99", 0)
+	p.Crash = c
+	p.OutputWriter = ioutil.Discard
+	p.Exec()
+	assert.Equal(t, []traceStep{
+		{Step: 1, IP: 4, Raw: ints{1101, 1, 2, 0}},
+		{Step: 2, IP: 8, Raw: ints{99}},
+	}, c.History())
+}
+
+func TestCoreDump(t *testing.T) {
+	// Reads two inputs and outputs their sum, but only one input is available
+	p := New("3,11,3,12,1,11,12,13,4,13,99", 3)
+	p.InputReader = strings.NewReader("5")
+	p.OutputWriter = ioutil.Discard
+	p.Crash = newCrashRecorder(10)
+	err := p.execRecover()
+	assert.EqualError(t, err, "EOF")
+
+	var buf bytes.Buffer
+	assert.NoError(t, newCoreDump(p, err).write(&buf))
+	core, err := readCoreDump(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "EOF", core.Error)
+	assert.Equal(t, 2, core.IP)
+	assert.Equal(t, int64(5), core.Memory[11])
+	assert.Len(t, core.History, 2)
+
+	// Resume with the missing input
+	resumed := core.Program()
+	resumed.InputReader = strings.NewReader("8")
+	var out bytes.Buffer
+	resumed.OutputWriter = &out
+	resumed.Exec()
+	assert.Equal(t, "13\n", out.String())
+}
+
+func TestCoreDump_PendingInputSource(t *testing.T) {
+	// Reads two inputs and crashes writing the second one to address -1
+	const crash = "3,20,3,-1"
+	filename := filepath.Join(t.TempDir(), "input")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("ab\ncd"), 0664))
+	file, err := os.Open(filename)
+	assert.NoError(t, err)
+	defer file.Close()
+	pipe, pipeWriter, err := os.Pipe()
+	assert.NoError(t, err)
+	defer pipe.Close()
+	defer pipeWriter.Close()
+
+	for _, test := range []struct {
+		name     string
+		source   InputSource
+		expected string
+	}{
+		{"chain", NewChainInput(NewValuesInput(1, 2, 3), NewNumberInput(strings.NewReader("4 5 \n"))), "3\n4\n5\n"},
+		// The characters read ahead into the buffer are pending
+		{"ascii", NewASCIIInput(file), "10\n99\n100\n10\n"},
+		// A pipe is not read
+		{"pipe", NewChainInput(NewValuesInput(1, 2, 3), NewNumberInput(pipe)), "3\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p := New(crash, 0)
+			p.InputSource = test.source
+			p.InputReader = nil
+			err := p.execRecover()
+			assert.Error(t, err)
+			assert.Equal(t, test.expected, newCoreDump(p, err).PendingInput)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// disassembleInstruction returns the instruction at address in a readable form
+// and the number of ints it occupies. Values that are no known instruction are
+// shown as data.
+func disassembleInstruction(memory ints, address int) (string, int) {
+	data := "data " + strconv.FormatInt(memory[address], 10)
+	if memory[address] < 0 {
+		return data, 1
+	}
+	info := opcodes[newOpcode(memory[address])]
+	if info.Fn == nil || address+1+info.ArgNum > len(memory) {
+		return data, 1
+	}
+
+	modes := NewModeList(memory[address], info.ArgNum)
+	args := make([]string, info.ArgNum)
+	for i, mode := range modes {
+		args[i] = formatArg(memory[address+1+i], mode)
+	}
+	return strings.TrimSpace(info.Name + " " + strings.Join(args, ", ")), 1 + info.ArgNum
+}
+
+// formatArg formats an argument according to its mode: [a] for position mode,
+// a for immediate mode and [rb+a] for relative mode.
+func formatArg(arg int64, mode Mode) string {
+	switch mode {
+	case 0:
+		return "[" + strconv.FormatInt(arg, 10) + "]"
+	case 1:
+		return strconv.FormatInt(arg, 10)
+	case 2:
+		if arg < 0 {
+			return "[rb" + strconv.FormatInt(arg, 10) + "]"
+		}
+		return "[rb+" + strconv.FormatInt(arg, 10) + "]"
+	default:
+		return mode.String() + "(" + strconv.FormatInt(arg, 10) + ")"
+	}
+}
+
+// printDisassembly writes count many instructions starting at address to w.
+// The instruction at ip is marked with an arrow.
+func printDisassembly(w io.Writer, memory ints, address int, count int, ip int) {
+	for i := 0; i < count && address < len(memory); i++ {
+		text, size := disassembleInstruction(memory, address)
+		marker := "  "
+		if address == ip {
+			marker = "->"
+		}
+		raw := memory[address : address+size]
+		fmt.Fprintf(w, "%s %6d: %-24s %s\n", marker, address, raw.String(), text)
+		address += size
+	}
+}
+
+// memoryViewerWidth is the number of ints shown per line by printMemory.
+const memoryViewerWidth = 10
+
+// printMemory writes count many ints starting at address to w, memoryViewerWidth
+// many per line.
+func printMemory(w io.Writer, memory ints, address int, count int) {
+	end := address + count
+	if end > len(memory) {
+		end = len(memory)
+	}
+	for line := address; line < end; line += memoryViewerWidth {
+		fmt.Fprintf(w, "%6d:", line)
+		for i := line; i < line+memoryViewerWidth && i < end; i++ {
+			fmt.Fprintf(w, " %6d", memory[i])
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDisassembleInstruction(t *testing.T) {
+	text, size := disassembleInstruction(ints{21201, 4, 5, -6}, 0)
+	assert.Equal(t, "Add [rb+4], 5, [rb-6]", text)
+	assert.Equal(t, 4, size)
+
+	text, size = disassembleInstruction(ints{99}, 0)
+	assert.Equal(t, "End", text)
+	assert.Equal(t, 1, size)
+
+	text, size = disassembleInstruction(ints{-5, 42}, 0)
+	assert.Equal(t, "data -5", text)
+	assert.Equal(t, 1, size)
+
+	// Not enough arguments
+	text, size = disassembleInstruction(ints{1, 2}, 0)
+	assert.Equal(t, "data 1", text)
+	assert.Equal(t, 1, size)
+}
+
+func TestPrintDisassembly(t *testing.T) {
+	var out bytes.Buffer
+	printDisassembly(&out, ints{104, 42, 99}, 0, 5, 2)
+	assert.Equal(t, "        0: 104,42                   Output 42\n"+
+		"->      2: 99                       End\n", out.String())
+}
+
+func TestPrintMemory(t *testing.T) {
+	var out bytes.Buffer
+	printMemory(&out, ints{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, 1, 20)
+	assert.Equal(t, "     1:      1      2      3      4      5      6      7      8      9     10\n"+
+		"    11:     11\n", out.String())
+}
@@ -0,0 +1,275 @@
+package main
+
+// maxInstructionSize is the number of ints of the longest instruction, i.e. the
+// opcode and three arguments.
+const maxInstructionSize = 4
+
+// decodedInstruction is an instruction decoded once by the fast dispatch loop,
+// so that the opcode and the modes do not have to be extracted from the raw
+// value on every execution.
+type decodedInstruction struct {
+	// op is the opcode to dispatch, which is a superinstruction if the
+	// instruction has been optimized.
+	op opcode
+	// base is the opcode of the instruction.
+	base   opcode
+	argNum uint8
+	modes  [maxInstructionSize - 1]Mode
+	// moveFrom is the argument copied by superMove.
+	moveFrom uint8
+	// jumpOp and jumpMode are the opcode and the target mode of the jump of
+	// superCompareJump.
+	jumpOp   opcode
+	jumpMode Mode
+	// valid indicates whether the instruction has been decoded and its ints
+	// have not been written since.
+	valid bool
+	// slow indicates whether the instruction has to be executed by the
+	// instrumented loop, e.g. because of an unknown opcode or mode, which
+	// results in the same error message or panic.
+	slow bool
+}
+
+// instrumented reports whether any feature is activated, which needs the
+// instrumented loop to see every instruction and memory access. The stats of an
+// optimized program are collected by the fast dispatch loop instead.
+func (p *Program) instrumented() bool {
+	return p.Stats.Activated && !p.Optimize || p.Debug || p.TraceWriter != nil || p.SelfMod != nil ||
+		p.CallStack != nil || p.Crash != nil || p.Profile != nil || p.Cover != nil
+}
+
+// execFast executes the program using a cache of decoded instructions keyed by
+// address, without heap allocations per instruction. Writes to the ints of a
+// decoded instruction invalidate it.
+func (p *Program) execFast() {
+	stats := p.Stats.Activated
+	if stats {
+		// Only the operations are counted, not the memory accesses
+		p.Stats.Activated = false
+		defer p.collectFastStats()
+	}
+	p.decoded = make([]decodedInstruction, len(p.Ints))
+	for p.IP < len(p.Ints) {
+		if p.IP >= len(p.decoded) {
+			p.growDecoded()
+		}
+		if !p.decoded[p.IP].valid {
+			p.decode(p.IP)
+		}
+		if p.Checkpoint != nil {
+			p.Checkpoint.execute(p)
+		}
+		if p.Loop != nil {
+			p.Loop.execute(p)
+		}
+		// Copy the instruction, because executing it may invalidate it
+		d := p.decoded[p.IP]
+		if d.slow {
+			p.MoveIP = true
+			op := newOpcode(p.Ints[p.IP])
+			if stats {
+				p.opCounts[op]++
+			}
+			modes := NewModeList(p.Ints[p.IP], opcodes[op].ArgNum)
+			p.execInstruction(op, p.newArgIndexList(p.IP+1, modes))
+			if p.Finish {
+				break
+			}
+			continue
+		}
+		if p.Progress != nil {
+			p.Progress.execute(p)
+		}
+		if stats {
+			p.opCounts[d.base]++
+		}
+
+		var args [maxInstructionSize - 1]int
+		for i := 0; i < int(d.argNum); i++ {
+			args[i] = p.argIndex(d.modes[i], p.IP+1+i)
+		}
+		jumped := false
+		switch d.op {
+		case 1:
+			p.store(args[2], p.load(args[0])+p.load(args[1]))
+		case 2:
+			p.store(args[2], p.load(args[0])*p.load(args[1]))
+		case 5:
+			if p.load(args[0]) != 0 {
+				p.IP = int(p.load(args[1]))
+				jumped = true
+			}
+		case 6:
+			if p.load(args[0]) == 0 {
+				p.IP = int(p.load(args[1]))
+				jumped = true
+			}
+		case 7:
+			p.store(args[2], boolToInt(p.load(args[0]) < p.load(args[1])))
+		case 8:
+			p.store(args[2], boolToInt(p.load(args[0]) == p.load(args[1])))
+		case 9:
+			p.RelBase += p.load(args[0])
+		case 99:
+			p.Finish = true
+		case superMove:
+			p.store(args[2], p.load(args[d.moveFrom]))
+			p.superCounts[d.op-superMove]++
+		case superJump:
+			p.IP = int(p.load(args[1]))
+			jumped = true
+			p.superCounts[d.op-superMove]++
+		case superCompareJump:
+			jumped = p.execCompareJump(d, args, stats)
+		default:
+			// Input, output and the additional instructions
+			p.argBuf = args
+			p.MoveIP = true
+			opcodes[d.op].Fn(p, p.argBuf[:d.argNum])
+			jumped = !p.MoveIP
+		}
+		p.Steps++
+		if p.Finish {
+			break
+		}
+		if !jumped {
+			p.IP += 1 + int(d.argNum)
+		}
+	}
+}
+
+// stepInterval schedules a hook, e.g. a checkpoint, every number of executed
+// instructions. It is measured by the steps of the program instead of the calls
+// of the hook, as a superinstruction executes several instructions at once.
+type stepInterval struct {
+	// next is the number of steps, after which the interval is due again.
+	next    int
+	started bool
+}
+
+// due reports whether the interval of every instructions is due before the
+// execution of the next instruction after steps instructions. The first
+// interval starts at the first call. If several intervals have passed since
+// the last call, it is due once, and the following intervals keep their
+// alignment.
+func (s *stepInterval) due(steps int, every int) bool {
+	if !s.started {
+		s.started = true
+		s.next = steps + every - 1
+	}
+	if steps < s.next {
+		return false
+	}
+	s.next += every * ((steps-s.next)/every + 1)
+	return true
+}
+
+// decode decodes the instruction at address into the cache.
+func (p *Program) decode(address int) {
+	d := &p.decoded[address]
+	*d = decodedInstruction{valid: true}
+	raw := p.Ints[address]
+	op := newOpcode(raw)
+	if raw < 0 || int(op) >= len(opcodes) || opcodes[op].Fn == nil {
+		d.slow = true
+		return
+	}
+	d.op = op
+	d.argNum = uint8(opcodes[op].ArgNum)
+	if address+int(d.argNum) >= len(p.Ints) {
+		d.slow = true
+		return
+	}
+	val := raw / 1e2
+	for i := 0; i < int(d.argNum); i++ {
+		d.modes[i] = Mode(val % 10)
+		val /= 10
+		if int(d.modes[i]) >= len(Modes) {
+			d.slow = true
+			return
+		}
+	}
+	d.base = op
+	if p.Optimize {
+		p.optimize(address, d)
+	}
+}
+
+// execCompareJump executes the compare of superCompareJump d with the argument
+// indexes args, followed by the jump. If the compare modifies the instructions,
+// the jump is executed separately after decoding it again. It reports whether
+// the IP has been set.
+func (p *Program) execCompareJump(d decodedInstruction, args [maxInstructionSize - 1]int, stats bool) bool {
+	a, b := p.load(args[0]), p.load(args[1])
+	result := boolToInt(a < b)
+	if d.base == 8 {
+		result = boolToInt(a == b)
+	}
+	p.store(args[2], result)
+	if !p.decoded[p.IP].valid {
+		return false
+	}
+
+	// The compare is counted here, the jump by the dispatch loop
+	p.Steps++
+	if stats {
+		p.opCounts[d.jumpOp]++
+	}
+	p.superCounts[d.op-superMove]++
+	jump := p.IP + 4
+	if (result != 0) == (d.jumpOp == 5) {
+		p.IP = int(p.load(p.argIndex(d.jumpMode, jump+2)))
+	} else {
+		p.IP = jump + 3
+	}
+	return true
+}
+
+// growDecoded increases the cache to the size of the memory.
+func (p *Program) growDecoded() {
+	decoded := make([]decodedInstruction, len(p.Ints))
+	copy(decoded, p.decoded)
+	p.decoded = decoded
+}
+
+// invalidate removes the instructions containing address from the cache.
+func (p *Program) invalidate(address int) {
+	size := maxInstructionSize
+	if p.Optimize {
+		size = maxSuperinstructionSize
+	}
+	for a := address - size + 1; a <= address; a++ {
+		if a >= 0 && a < len(p.decoded) {
+			p.decoded[a].valid = false
+		}
+	}
+}
+
+// argIndex returns the index of the argument at index in mode.
+func (p *Program) argIndex(mode Mode, index int) int {
+	switch mode {
+	case 1:
+		return index
+	case 2:
+		return int(p.RelBase + p.Ints[index])
+	default:
+		return int(p.Ints[index])
+	}
+}
+
+// load is Get without instrumentation.
+func (p *Program) load(index int) int64 {
+	p.increaseMemoryIfNecessary(index)
+	return p.Ints[index]
+}
+
+// store is Set without instrumentation.
+func (p *Program) store(index int, value int64) {
+	p.increaseMemoryIfNecessary(index)
+	p.invalidate(index)
+	p.markDirty(index)
+	if p.Loop != nil {
+		p.Loop.write(index)
+	}
+	p.Ints[index] = value
+}
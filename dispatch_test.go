@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// day9Quine outputs a copy of itself.
+const day9Quine = "109,1,204,-1,1001,100,1,100,1008,100,16,101,1006,101,0,99"
+
+// day9LargeNumber outputs a 16-digit number.
+const day9LargeNumber = "1102,34915192,34915192,7,4,7,99,0"
+
+// countLoop counts to 100000 without output.
+const countLoop = "1001,100,1,100,1007,100,100000,101,1005,101,0,99"
+
+// execBoth executes source with input by the fast and by the instrumented loop
+// and returns both results.
+func execBoth(t *testing.T, source string, input string) (fast *Program, instrumented *Program) {
+	var fastOut, instrumentedOut bytes.Buffer
+	fast = New(source, 100)
+	fast.InputReader = strings.NewReader(input)
+	fast.OutputWriter = &fastOut
+	fast.Exec()
+
+	instrumented = New(source, 100)
+	instrumented.InputReader = strings.NewReader(input)
+	instrumented.OutputWriter = &instrumentedOut
+	instrumented.execInstrumented()
+
+	assert.Equal(t, instrumentedOut.String(), fastOut.String())
+	assert.Equal(t, instrumented.Ints, fast.Ints)
+	assert.Equal(t, instrumented.Steps, fast.Steps)
+	return fast, instrumented
+}
+
+func TestExecFast(t *testing.T) {
+	day5, err := ioutil.ReadFile("examples/program.ic")
+	assert.NoError(t, err)
+	execBoth(t, string(day5), "1")
+	execBoth(t, string(day5), "5")
+	execBoth(t, day9LargeNumber, "")
+	fib, err := ioutil.ReadFile("examples/fib.ic")
+	assert.NoError(t, err)
+	p, _ := execBoth(t, string(fib), "20")
+	assert.Equal(t, int64(6765), p.Ints[102])
+
+	var out bytes.Buffer
+	p = New(day9Quine, 100)
+	p.OutputWriter = &out
+	p.Exec()
+	assert.Equal(t, strings.ReplaceAll(day9Quine, ",", "\n")+"\n", out.String())
+}
+
+func TestExecFast_SelfModifying(t *testing.T) {
+	// The add at 0 is executed, replaced by a multiply and executed again
+	p, _ := execBoth(t, "1101,5,5,200,1001,201,1,201,1008,201,2,202,1005,202,22,1101,0,1102,0,1105,1,0,99", "")
+	assert.Equal(t, int64(25), p.Ints[200])
+}
+
+func TestExecFast_Allocations(t *testing.T) {
+	p := New(countLoop, 100)
+	allocs := testing.AllocsPerRun(10, func() {
+		p.IP, p.Finish, p.Ints[100] = 0, false, 0
+		p.Exec()
+	})
+	// Only the cache is allocated
+	assert.Equal(t, 1.0, allocs)
+}
+
+func TestExecFast_UnknownOpcode(t *testing.T) {
+	p := New("42,99", 0)
+	p.DebugWriter = ioutil.Discard
+	assert.Panics(t, p.Exec)
+}
+
+func BenchmarkExec(b *testing.B) {
+	day5, err := ioutil.ReadFile("examples/program.ic")
+	if err != nil {
+		b.Fatal(err)
+	}
+	// Recursive calls on a stack at the relative base like the day 9 BOOST
+	// program, which run about 2.3 million instructions
+	fib, err := ioutil.ReadFile("examples/fib.ic")
+	if err != nil {
+		b.Fatal(err)
+	}
+	programs := []struct {
+		name   string
+		source string
+		input  string
+	}{
+		{"day5", string(day5), "5"},
+		{"day9-quine", day9Quine, ""},
+		{"day9-large-number", day9LargeNumber, ""},
+		{"fib", string(fib), "25"},
+		{"count", countLoop, ""},
+	}
+	loops := []struct {
+		name string
+		exec func(p *Program)
+	}{
+		{"instrumented", (*Program).execInstrumented},
+		{"fast", (*Program).execFast},
+		{"optimized", func(p *Program) {
+			p.Optimize = true
+			p.execFast()
+		}},
+	}
+	for _, program := range programs {
+		parsed := New(program.source, 100)
+		for _, loop := range loops {
+			b.Run(program.name+"/"+loop.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					p := New("99", 0)
+					p.Ints = append(ints{}, parsed.Ints...)
+					p.InputReader = strings.NewReader(program.input)
+					p.OutputWriter = ioutil.Discard
+					loop.exec(p)
+				}
+			})
+		}
+	}
+}
+
+func TestStepInterval(t *testing.T) {
+	var s stepInterval
+	var due []int
+	// The steps advance by 2 from 10 on, like for compare-jumps
+	for steps := 0; steps < 20; steps++ {
+		if s.due(steps, 3) {
+			due = append(due, steps)
+		}
+		if steps >= 10 {
+			steps++
+		}
+	}
+	assert.Equal(t, []int{2, 5, 8, 12, 14, 18}, due)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// inspectCommand shows a core dump and browses it interactively, or resumes
+// the execution of the crashed program.
+func inspectCommand(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s inspect <flags> <core>\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	resume := fs.Bool("resume", false, "Resume the execution at the crashed instruction instead of browsing the core dump")
+	input := fs.String("input", "", "File to read further input values from after the pending input, if -resume is set")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	core, err := readCoreDump(file)
+	file.Close()
+	if err != nil {
+		panic(err)
+	}
+
+	if *resume {
+		resumeCore(core, *input)
+		return
+	}
+	inspector := &coreInspector{core: core, w: os.Stdout}
+	inspector.summary()
+	inspector.browse(os.Stdin)
+}
+
+// resumeCore resumes the execution of the crashed program. The pending input
+// of the core dump is read first, then the input of inputFilename, or stdin if
+// it is empty.
+func resumeCore(core *coreDump, inputFilename string) {
+	p := core.Program()
+	var input io.Reader = os.Stdin
+	if inputFilename != "" {
+		file, err := os.Open(inputFilename)
+		if err != nil {
+			panic(err)
+		}
+		defer file.Close()
+		input = file
+	}
+	p.InputReader = io.MultiReader(strings.NewReader(core.PendingInput), input)
+	p.Exec()
+}
+
+// coreInspector browses a core dump.
+type coreInspector struct {
+	core *coreDump
+	w    io.Writer
+}
+
+// inspectorHelp lists the commands of the core inspector.
+const inspectorHelp = `Commands:
+  summary               Show error, registers, call stack and recent instructions
+  dis [addr] [count]    Disassemble count instructions starting at addr (default: IP)
+  mem [addr] [count]    Show count ints of memory starting at addr (default: 0)
+  history               Show the last executed instructions
+  output                Show the outputs so far
+  input                 Show the pending input
+  stats                 Show the stats
+  quit                  Quit the inspector
+`
+
+// browse reads commands from r until EOF or the quit command.
+func (i *coreInspector) browse(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(i.w, "(inspect) ")
+		if !scanner.Scan() {
+			fmt.Fprintln(i.w)
+			return
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "q" {
+			return
+		}
+		if err := i.exec(fields[0], fields[1:]); err != nil {
+			fmt.Fprintln(i.w, "Error:", err)
+		}
+	}
+}
+
+// exec executes a single inspector command.
+func (i *coreInspector) exec(command string, args []string) error {
+	switch command {
+	case "summary":
+		i.summary()
+	case "dis":
+		address, count, err := parseRange(args, i.core.IP, 10)
+		if err != nil {
+			return err
+		}
+		printDisassembly(i.w, i.core.Memory, address, count, i.core.IP)
+	case "mem":
+		address, count, err := parseRange(args, 0, 100)
+		if err != nil {
+			return err
+		}
+		printMemory(i.w, i.core.Memory, address, count)
+	case "history":
+		i.history()
+	case "output":
+		fmt.Fprintln(i.w, i.core.Outputs.String())
+	case "input":
+		fmt.Fprintf(i.w, "%q\n", i.core.PendingInput)
+	case "stats":
+		if i.core.Stats == nil {
+			fmt.Fprintln(i.w, "No stats recorded")
+		} else {
+			fmt.Fprintln(i.w, string(i.core.Stats))
+		}
+	default:
+		fmt.Fprint(i.w, inspectorHelp)
+	}
+	return nil
+}
+
+// summary shows the error, the registers, the call stack, the recent
+// instructions and the disassembly around IP.
+func (i *coreInspector) summary() {
+	core := i.core
+	fmt.Fprintf(i.w, "Crash: %s\n", core.Error)
+	fmt.Fprintf(i.w, "IP %d, RelBase %d, Steps %d, Memory %d ints\n", core.IP, core.RelBase, core.Steps, len(core.Memory))
+	if len(core.CallStack) > 0 {
+		c := &callStack{Frames: core.CallStack}
+		fmt.Fprint(i.w, "Call stack:\n"+c.backtrace(core.IP))
+	}
+	i.history()
+	fmt.Fprintln(i.w, "Disassembly:")
+	if core.IP >= 0 && core.IP < len(core.Memory) {
+		printDisassembly(i.w, core.Memory, core.IP, 5, core.IP)
+	}
+	fmt.Fprintf(i.w, "%d outputs, %d bytes of pending input\n", len(core.Outputs), len(core.PendingInput))
+}
+
+// history shows the last executed instructions.
+func (i *coreInspector) history() {
+	fmt.Fprintln(i.w, "Last executed instructions:")
+	for _, step := range i.core.History {
+		text, _ := disassembleInstruction(step.Raw, 0)
+		fmt.Fprintf(i.w, "  step %6d  IP %6d  rb %6d  %s\n", step.Step, step.IP, step.RelBase, text)
+	}
+}
+
+// parseRange parses the optional address and count arguments of an inspector
+// command.
+func parseRange(args []string, defaultAddress int, defaultCount int) (int, int, error) {
+	address, count := defaultAddress, defaultCount
+	var err error
+	if len(args) > 0 {
+		if address, err = strconv.Atoi(args[0]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if len(args) > 1 {
+		if count, err = strconv.Atoi(args[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if address < 0 {
+		return 0, 0, fmt.Errorf("invalid address %d", address)
+	}
+	return address, count, nil
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
-	"fmt"
+	"io"
 	"math/rand"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -17,26 +18,66 @@ func Multiply(p *Program, argIndexes []int) {
 	p.Set(argIndexes[2], p.Get(argIndexes[0])*p.Get(argIndexes[1]))
 }
 
-// Input prints an input message on Program.DebugWriter and then reads an input
-// from Program.InputReader to arg[0].
+// inputPollInterval is the time between two reads of the input, while
+// waiting for more input at its end.
+const inputPollInterval = 100 * time.Millisecond
+
+// Input reads an input from Program.InputSource to arg[0]. Without an input
+// source, it prints an input message on Program.DebugWriter and then reads an
+// input from Program.InputReader. The end of the input is handled by
+// Program.EOF.
 func Input(p *Program, argIndexes []int) {
-	// Show input prompt
-	if p.InputReader == os.Stdin {
-		fmt.Fprint(p.DebugWriter, "Input: ")
+	// Show buffered output before waiting for the input
+	p.flushOutput()
+
+	in := p.InputSource
+	if in == nil {
+		number := &numberInput{r: p.InputReader}
+		if p.InputReader == os.Stdin {
+			number.prompt = p.DebugWriter
+		}
+		in = number
 	}
 
 	// Read input value
-	var value int64
-	_, err := fmt.Fscanf(p.InputReader, "%d", &value)
+	value, err := in.ReadInput()
+	for err == io.EOF && p.EOF.Action == EOFBlock {
+		time.Sleep(inputPollInterval)
+		value, err = in.ReadInput()
+	}
+	if err == io.EOF {
+		switch p.EOF.Action {
+		case EOFHalt:
+			// Stay at the input instruction
+			p.MoveIP = false
+			p.Finish = true
+			return
+		case EOFSentinel:
+			value, err = p.EOF.Sentinel, nil
+		}
+	}
 	if err != nil {
 		panic(err)
 	}
+	p.Inputs++
 	p.Set(argIndexes[0], value)
 }
 
-// Output prints arg[0] to Program.OutputWriter.
+// Output writes arg[0] to Program.OutputSink, or prints it to
+// Program.OutputWriter without an output sink.
 func Output(p *Program, argIndexes []int) {
-	fmt.Fprintln(p.OutputWriter, p.Get(argIndexes[0]))
+	value := p.Get(argIndexes[0])
+	if p.Crash != nil {
+		p.Crash.output(value)
+	}
+	p.Outputs++
+	if p.OutputSink != nil {
+		p.OutputSink.WriteOutput(value)
+		return
+	}
+	// Format the value without fmt, which is slow for output heavy programs
+	line := append(strconv.AppendInt(p.outputLine[:0], value, 10), '\n')
+	p.OutputWriter.Write(line)
 }
 
 // JumpNonZero sets Program.IP to arg[1], if arg[0] is non-zero.
@@ -76,61 +117,67 @@ func AddRelativeBase(p *Program, argIndexes []int) {
 
 // BitAnd performs a bitwise and (a & b).
 func BitAnd(p *Program, argIndexes []int) {
-	p.Ints[argIndexes[2]] = p.Ints[argIndexes[0]] & p.Ints[argIndexes[1]]
+	p.Set(argIndexes[2], p.Get(argIndexes[0])&p.Get(argIndexes[1]))
 }
 
 // BitOr performs a bitwise or (a | b).
 func BitOr(p *Program, argIndexes []int) {
-	p.Ints[argIndexes[2]] = p.Ints[argIndexes[0]] | p.Ints[argIndexes[1]]
+	p.Set(argIndexes[2], p.Get(argIndexes[0])|p.Get(argIndexes[1]))
 }
 
 // BitXor performs a bitwise xor (a ^ b).
 func BitXor(p *Program, argIndexes []int) {
-	p.Ints[argIndexes[2]] = p.Ints[argIndexes[0]] ^ p.Ints[argIndexes[1]]
+	p.Set(argIndexes[2], p.Get(argIndexes[0])^p.Get(argIndexes[1]))
 }
 
 // Division performs a integer division (a / b).
 func Division(p *Program, argIndexes []int) {
-	p.Ints[argIndexes[2]] = p.Ints[argIndexes[0]] / p.Ints[argIndexes[1]]
+	p.Set(argIndexes[2], p.Get(argIndexes[0])/p.Get(argIndexes[1]))
 }
 
 // Modulo performs modulo (a % b).
 func Modulo(p *Program, argIndexes []int) {
-	p.Ints[argIndexes[2]] = p.Ints[argIndexes[0]] % p.Ints[argIndexes[1]]
+	p.Set(argIndexes[2], p.Get(argIndexes[0])%p.Get(argIndexes[1]))
 }
 
 // LeftShift performs a left shift (a << b).
 func LeftShift(p *Program, argIndexes []int) {
-	p.Ints[argIndexes[2]] = p.Ints[argIndexes[0]] << p.Ints[argIndexes[1]]
+	p.Set(argIndexes[2], p.Get(argIndexes[0])<<p.Get(argIndexes[1]))
 }
 
 // RightShift performs a right shift (a >> b).
 func RightShift(p *Program, argIndexes []int) {
-	p.Ints[argIndexes[2]] = p.Ints[argIndexes[0]] >> p.Ints[argIndexes[1]]
+	p.Set(argIndexes[2], p.Get(argIndexes[0])>>p.Get(argIndexes[1]))
 }
 
 // Negate negates the value. Returns 1 if v == 0, and returns 0 otherwise.
 func Negate(p *Program, argIndexes []int) {
-	p.Ints[argIndexes[1]] = boolToInt(!intToBool(p.Ints[argIndexes[0]]))
+	p.Set(argIndexes[1], boolToInt(!intToBool(p.Get(argIndexes[0]))))
 }
 
 // Timestamp returns the current unix timestamp.
 func Timestamp(p *Program, argIndexes []int) {
-	p.Ints[argIndexes[0]] = time.Now().Unix()
+	if p.Loop != nil {
+		p.Loop.external()
+	}
+	p.Set(argIndexes[0], time.Now().Unix())
 }
 
 // Random return a random positive number.
 func Random(p *Program, argIndexes []int) {
-	p.Ints[argIndexes[0]] = rand.Int63()
+	if p.Loop != nil {
+		p.Loop.external()
+	}
+	p.Set(argIndexes[0], rand.Int63())
 }
 
 // Absolute calculates the positive value of argIndexes[0] and saves it into argIndexes[1]
 func Absolute(p *Program, argIndexes []int) {
-	if p.Ints[argIndexes[0]] < 0 {
-		p.Ints[argIndexes[1]] = -p.Ints[argIndexes[0]]
-	} else {
-		p.Ints[argIndexes[1]] = p.Ints[argIndexes[0]]
+	value := p.Get(argIndexes[0])
+	if value < 0 {
+		value = -value
 	}
+	p.Set(argIndexes[1], value)
 }
 
 // Syscall performs a syscall.
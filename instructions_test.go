@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOutput(t *testing.T) {
+	var out bytes.Buffer
+	p := New("104,0,104,-42,104,-9223372036854775808,99", 0)
+	p.OutputWriter = &out
+	p.Exec()
+	assert.Equal(t, "0\n-42\n-9223372036854775808\n", out.String())
+}
+
+// readerFunc is an io.Reader calling itself.
+type readerFunc func(b []byte) (int, error)
+
+func (r readerFunc) Read(b []byte) (int, error) {
+	return r(b)
+}
+
+func TestOutput_Flush(t *testing.T) {
+	var out bytes.Buffer
+	p := New("104,7,3,9,104,8,99,0,0,0", 0)
+	p.OutputWriter = bufio.NewWriter(&out)
+	input := strings.NewReader("1")
+	outputBeforeInput := ""
+	p.InputReader = readerFunc(func(b []byte) (int, error) {
+		outputBeforeInput = out.String()
+		return input.Read(b)
+	})
+	p.Exec()
+	// Flushed on input and on halt
+	assert.Equal(t, "7\n", outputBeforeInput)
+	assert.Equal(t, "7\n8\n", out.String())
+
+	// Flushed on error
+	out.Reset()
+	p = New("104,7,42", 0)
+	p.OutputWriter = bufio.NewWriter(&out)
+	p.DebugWriter = ioutil.Discard
+	assert.Panics(t, p.Exec)
+	assert.Equal(t, "7\n", out.String())
+}
+
+// outputMillion outputs the numbers from 0 to 999999.
+const outputMillion = "4,100,1001,100,1,100,1007,100,1000000,101,1005,101,0,99"
+
+// fprintlnOutput is the former Output using fmt.
+func fprintlnOutput(p *Program, argIndexes []int) {
+	fmt.Fprintln(p.OutputWriter, p.Get(argIndexes[0]))
+}
+
+func BenchmarkOutput(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+	output := opcodes[4].Fn
+	defer func() {
+		opcodes[4].Fn = output
+	}()
+
+	writers := []struct {
+		name   string
+		output func(p *Program, argIndexes []int)
+		writer func() io.Writer
+	}{
+		{"fmt/unbuffered", fprintlnOutput, func() io.Writer { return devNull }},
+		{"fast/unbuffered", output, func() io.Writer { return devNull }},
+		{"fmt/buffered", fprintlnOutput, func() io.Writer { return bufio.NewWriterSize(devNull, outputBufferSize) }},
+		{"fast/buffered", output, func() io.Writer { return bufio.NewWriterSize(devNull, outputBufferSize) }},
+	}
+	for _, w := range writers {
+		b.Run(w.name, func(b *testing.B) {
+			opcodes[4].Fn = w.output
+			for i := 0; i < b.N; i++ {
+				p := New(outputMillion, 100)
+				p.OutputWriter = w.writer()
+				p.Exec()
+			}
+		})
+	}
+}
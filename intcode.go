@@ -1,56 +1,240 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
+	"time"
 )
 
 const version = "v9.3"
 
+// outputBufferSize is the size of the buffer of the output values in bytes.
+const outputBufferSize = 64 << 10
+
 var (
 	executedProgramFilename string
 	executedProgramFile     *os.File
 	outputFilename          string
 	outputFile              *os.File
-	inputFilename           string
-	inputFile               *os.File
+	inputSpecs              []inputSpec
+	inputSource             InputSource
+	inputFiles              []*os.File
+	eofPolicy               EOFPolicy
+	traceFilename           string
+	traceFile               *os.File
 	showDebug               bool
 	showStats               bool
+	statsFormat             string
+	statsFilename           string
+	showMemDiff             bool
+	showSelfMod             bool
+	callConventionName      string
+	coreFilename            string
+	coreHistoryLen          int
+	profileFilename         string
+	symbolsFilename         string
+	coverFilename           string
+	progressInterval        time.Duration
+	optimize                bool
+	progressFilename        string
+	checkpointFilename      string
+	checkpointEvery         int
+	loopCheckInterval       int
+	memoryPatches           []MemoryPatch
+	asciiMode               bool
 	additionalMemory        uint
 )
 
+type command struct {
+	Description string
+	Fn          func(args []string)
+}
+
+// commands are the subcommands, which are called with the remaining arguments
+// if their name is the first argument.
+var commands = map[string]command{
+	"tracediff": {
+		Description: "Compare two traces and report the first differing step",
+		Fn:          traceDiffCommand,
+	},
+	"memdiff": {
+		Description: "Show the memory changed by executing a program",
+		Fn:          memDiffCommand,
+	},
+	"batch": {
+		Description: "Run a program with many input files in parallel and report the results",
+		Fn:          batchCommand,
+	},
+	"bench": {
+		Description: "Run a program repeatedly and summarize its performance",
+		Fn:          benchCommand,
+	},
+	"transpile": {
+		Description: "Transpile a program into source code of another language",
+		Fn:          transpileCommand,
+	},
+	"cover": {
+		Description: "Show the coverage of a program as a text or HTML listing",
+		Fn:          coverCommand,
+	},
+	"inspect": {
+		Description: "Browse a core dump of a crashed program or resume it",
+		Fn:          inspectCommand,
+	},
+	"search": {
+		Description: "Search for memory patches, for which the final memory or the output matches a condition",
+		Fn:          searchCommand,
+	},
+	"resume": {
+		Description: "Resume the execution of a program from a checkpoint",
+		Fn:          resumeCommand,
+	},
+}
+
 func main() {
 	flags()
+	if command, ok := commands[flag.Arg(0)]; ok {
+		command.Fn(flag.Args()[1:])
+		return
+	}
 	openFiles()
 	defer executedProgramFile.Close()
-	defer inputFile.Close()
+	defer closeFiles(inputFiles)
+	defer traceFile.Close()
 
 	programFilename := flag.Arg(0)
 	if programFilename == "" {
 		printInfo()
 		return
 	}
-	programFile, err := ioutil.ReadFile(programFilename)
+	if checkpointEvery > 0 && checkpointFilename == "" {
+		checkpointFilename = programFilename + ".state"
+	}
+	runProgram(openProgram(programFilename))
+}
+
+// openProgram parses the program in filename while reading it. A syntax error
+// panics with the file name and the position of the invalid int.
+func openProgram(filename string) *Program {
+	file, err := os.Open(filename)
 	if err != nil {
 		panic(err)
 	}
-
-	runProgram(string(programFile))
+	defer file.Close()
+	p, err := NewFromReader(file, additionalMemory)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %v", filename, err))
+	}
+	return p
 }
 
-// runProgram creates a new program, executes it, prints the executed program and shows stats
-func runProgram(str string) {
-	// Create a new program and execute it
-	p := New(str, additionalMemory)
-	p.InputReader = inputFile
+// runProgram executes the program, prints the executed program and shows stats,
+// the memory diff and self-modifications
+func runProgram(p *Program) {
+	p.InputSource = inputSource
+	p.InputReader = nil
+	p.EOF = eofPolicy
+	if showDebug {
+		// Keep the output in order with the debug output
+		p.OutputWriter = outputFile
+	} else {
+		p.OutputWriter = bufio.NewWriterSize(outputFile, outputBufferSize)
+	}
+	if asciiMode {
+		p.OutputSink = NewASCIIOutput(p.OutputWriter)
+	}
 	p.Debug = showDebug
+	p.Optimize = optimize
+	// The coverage belongs to the program file, not to the patched program
+	if coverFilename != "" {
+		p.Cover = newCoverage(p)
+	}
+	if err := p.Patch(memoryPatches...); err != nil {
+		panic(err)
+	}
+	if traceFile != nil {
+		p.TraceWriter = traceFile
+	}
 	if showStats {
-		p.Stats = newStats()
+		p.Stats = NewStats()
+	}
+	if showSelfMod {
+		p.SelfMod = newSelfModTracker(p.DebugWriter)
+	}
+	if callConventionName != "" {
+		convention, ok := callConventions[callConventionName]
+		if !ok {
+			panic("Unknown calling convention " + callConventionName)
+		}
+		p.CallStack = newCallStack(convention)
+		defer func() {
+			// Show call stack on crash
+			if r := recover(); r != nil {
+				fmt.Fprint(os.Stderr, "Call stack:\n"+p.CallStack.backtrace(p.IP))
+				panic(r)
+			}
+		}()
+	}
+	if profileFilename != "" {
+		p.Profile = newProfiler()
+		if symbolsFilename != "" {
+			readSymbols(p.Profile)
+		}
+	}
+	// SIGUSR1 is only handled if progress reports are requested
+	if progressInterval > 0 || progressFilename != "" && progressSignalSupported {
+		p.Progress = newProgressReporter(os.Stderr, progressInterval)
+		if progressFilename != "" {
+			progressFile, err := os.OpenFile(progressFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+			if err != nil {
+				panic(err)
+			}
+			defer progressFile.Close()
+			p.Progress.Writer = progressFile
+		}
+		notifyProgress(p.Progress)
+	}
+	if checkpointEvery > 0 {
+		p.Checkpoint = newCheckpointer(checkpointFilename, checkpointEvery)
+		p.Checkpoint.Input = inputSpecs
+		p.Checkpoint.ASCII = asciiMode
+		if outputFilename != "" {
+			p.Checkpoint.output = outputFile
+		}
+	}
+	if loopCheckInterval > 0 {
+		p.Loop = newLoopDetector(loopCheckInterval)
+		defer func() {
+			// Report infinite loops without a stack trace
+			if r := recover(); r != nil {
+				if loopErr, ok := r.(*LoopError); ok {
+					fmt.Fprintln(os.Stderr, "Error:", loopErr)
+					os.Exit(1)
+				}
+				panic(r)
+			}
+		}()
+	}
+	var initialInts ints
+	if showMemDiff {
+		initialInts = make(ints, len(p.Ints))
+		copy(initialInts, p.Ints)
+	}
+	if coreFilename != "" {
+		p.Crash = newCrashRecorder(coreHistoryLen)
+		if err := p.execRecover(); err != nil {
+			writeCore(p, err)
+			os.Exit(1)
+		}
+	} else {
+		p.Exec()
 	}
-	p.Exec()
 
 	// Print executed program
 	if executedProgramFile != nil {
@@ -59,13 +243,129 @@ func runProgram(str string) {
 
 	// Show stats
 	if showStats {
-		fmt.Fprintln(os.Stderr, "Stats:")
-		fmt.Fprintln(os.Stderr, p.Stats.String())
+		writeStats(&p.Stats)
+	}
+
+	// Show memory diff
+	if showMemDiff {
+		printMemoryChanges(os.Stderr, diffMemoryRanges(initialInts, p.Ints, p.CodeLen))
+	}
+
+	// Show self-modifications
+	if showSelfMod {
+		fmt.Fprint(os.Stderr, p.SelfMod.String())
+	}
+
+	// Write profile
+	if profileFilename != "" {
+		writeProfile(p)
+	}
+
+	// Write coverage
+	if coverFilename != "" {
+		saveCoverage(coverFilename, p.Cover)
 	}
 }
 
-// openFiles opens the executed program file, the output file and the input file
-// specified by their filename variable.
+// writeStats writes the stats in the stats format to the stats file, or to
+// stderr if no stats file is specified.
+func writeStats(s *Stats) {
+	// The stats format has been checked by flags
+	write := statsFormats[statsFormat]
+	if statsFilename == "" {
+		if statsFormat == "text" {
+			fmt.Fprintln(os.Stderr, "Stats:")
+		}
+		if err := write(s, os.Stderr); err != nil {
+			panic(err)
+		}
+		return
+	}
+	file, err := os.OpenFile(statsFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	if err := write(s, file); err != nil {
+		panic(err)
+	}
+}
+
+// readSymbols reads the symbol file into the profiler.
+func readSymbols(pr *profiler) {
+	file, err := os.Open(symbolsFilename)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	if err := pr.readSymbols(file); err != nil {
+		panic(fmt.Errorf("%s: %w", symbolsFilename, err))
+	}
+}
+
+// writeProfile writes the pprof profile to the profile file and the listing
+// of the program next to it.
+func writeProfile(p *Program) {
+	listingFilename := profileFilename + ".lst"
+	listingFile, err := os.OpenFile(listingFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		panic(err)
+	}
+	defer listingFile.Close()
+	if err := p.Profile.writeListing(listingFile, p.Ints); err != nil {
+		panic(err)
+	}
+
+	profileFile, err := os.OpenFile(profileFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		panic(err)
+	}
+	defer profileFile.Close()
+	absListingFilename, err := filepath.Abs(listingFilename)
+	if err != nil {
+		panic(err)
+	}
+	if err := p.Profile.writePprof(profileFile, absListingFilename); err != nil {
+		panic(err)
+	}
+}
+
+// writeCore writes a core dump of the program, which has crashed with
+// crashErr, to the core file.
+func writeCore(p *Program, crashErr error) {
+	fmt.Fprintf(os.Stderr, "Program crashed at IP %d: %v\n", p.IP, crashErr)
+	if p.CallStack != nil {
+		fmt.Fprint(os.Stderr, "Call stack:\n"+p.CallStack.backtrace(p.IP))
+	}
+	file, err := os.OpenFile(coreFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	if err := newCoreDump(p, crashErr).write(file); err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(os.Stderr, "Core dump written to", coreFilename)
+}
+
+// loadProgram parses the program in programFilename. The input is read from
+// inputFilename, or from stdin if it is empty. The returned function closes the
+// input file.
+func loadProgram(programFilename string, inputFilename string) (*Program, func()) {
+	p := openProgram(programFilename)
+	if inputFilename == "" {
+		return p, func() {}
+	}
+	input, err := os.Open(inputFilename)
+	if err != nil {
+		panic(err)
+	}
+	p.InputReader = input
+	return p, func() { input.Close() }
+}
+
+// openFiles opens the executed program file, the output file, the input file
+// and the trace file specified by their filename variable.
 func openFiles() {
 	// Open executed program file
 	if executedProgramFilename == "" {
@@ -91,12 +391,17 @@ func openFiles() {
 		}
 	}
 
-	// Open input file
-	if inputFilename == "" {
-		inputFile = os.Stdin
-	} else {
+	// Open input files
+	var err error
+	inputSource, inputFiles, err = openInputs(inputSpecs, asciiMode, eofPolicy.Action == EOFBlock, os.Stderr)
+	if err != nil {
+		panic(err)
+	}
+
+	// Open trace file
+	if traceFilename != "" {
 		var err error
-		inputFile, err = os.Open(inputFilename)
+		traceFile, err = os.OpenFile(traceFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
 		if err != nil {
 			panic(err)
 		}
@@ -106,18 +411,71 @@ func openFiles() {
 // flags parsed the program arguments into the variables.
 func flags() {
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s <flags> <filename>\n\n", os.Args[0])
-		fmt.Fprintln(flag.CommandLine.Output(), "Flags:")
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s <flags> <filename>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s <flags> <command> <args>\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Commands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %-12s%s\n", name, commands[name].Description)
+		}
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
 		flag.PrintDefaults()
 	}
 	flag.StringVar(&executedProgramFilename, "executed-program", "", "File to print the executed program to. Use '-' to print to console")
-	flag.StringVar(&inputFilename, "input", "", "File to read input values from")
+	flag.Var(inputFlag{specs: &inputSpecs}, "input", "File to read input values from, or '-' for stdin. "+
+		"Can be repeated and combined with -in to read the sources one after another in their order. Defaults to stdin")
+	flag.Var(inputFlag{specs: &inputSpecs, values: true}, "in", "Comma separated input values, e.g. '1,5,42'. "+
+		"Can be repeated and combined with -input")
+	flag.Var(&eofPolicy, "eof", "What happens when reading beyond the end of the input: "+
+		"crash with an 'error', 'halt' the program, 'block' until there is more input, or read an int like -1")
 	flag.StringVar(&outputFilename, "output", "", "File to print output values to")
+	flag.StringVar(&traceFilename, "trace", "", "File to write a trace of every executed instruction to")
 	flag.BoolVar(&showDebug, "showDebug", false, "Trace program execution via showDebug output")
 	flag.BoolVar(&showStats, "stats", false, "Show statistics about execution duration and memory accesses")
+	flag.StringVar(&statsFormat, "stats-format", "text", "Format of the stats ("+strings.Join(statsFormatNames(), ", ")+")")
+	flag.StringVar(&statsFilename, "stats-file", "", "File to write the stats to instead of stderr. Implies -stats")
+	flag.BoolVar(&showMemDiff, "memdiff", false, "Show the memory changed by the execution")
+	flag.BoolVar(&showSelfMod, "selfmod", false, "Warn about self-modifying code and show a summary of it")
+	flag.StringVar(&callConventionName, "callstack", "", "Reconstruct the call stack using a calling convention ("+
+		strings.Join(callConventionNames(), ", ")+") and show it in debug output and on crashes")
+	flag.StringVar(&coreFilename, "core", "", "File to write a core dump to, if the program crashes")
+	flag.IntVar(&coreHistoryLen, "core-history", 20, "Number of last executed instructions in the core dump")
+	flag.StringVar(&profileFilename, "profile", "", "File to write a pprof profile of the executions and memory accesses "+
+		"per instruction address to. The listing of the program is written to the file with the suffix .lst")
+	flag.StringVar(&symbolsFilename, "symbols", "", "File with lines of '<address> <name>' to name the functions in the profile")
+	flag.StringVar(&coverFilename, "cover", "", "File to merge the coverage of executed instructions and conditional jumps into")
+	flag.DurationVar(&progressInterval, "progress", 0, "Interval of progress reports, e.g. 10s. "+
+		"A report can also be requested by sending SIGUSR1 while reports are enabled")
+	flag.StringVar(&progressFilename, "progress-file", "", "File to write the progress reports to instead of stderr. "+
+		"Without -progress, reports are only written on SIGUSR1")
+	flag.IntVar(&checkpointEvery, "checkpoint-every", 0, "Number of executed instructions between two checkpoints "+
+		"of the program state, from which the execution can be continued by the resume command")
+	flag.StringVar(&checkpointFilename, "checkpoint", "", "File to save the checkpoints to. Defaults to the program file with the suffix .state")
+	flag.IntVar(&loopCheckInterval, "detect-loops", 0, "Number of executed instructions between two checks, "+
+		"whether the program is stuck in an infinite loop without input and output, e.g. 10000")
+	flag.BoolVar(&optimize, "optimize", false, "Fuse idioms and sequences of instructions into superinstructions. "+
+		"The stats only count the operations and superinstructions then")
+	flag.BoolVar(&asciiMode, "ascii", false, "Read the input lines as ASCII characters followed by a newline, "+
+		"and print the output values 0 to 127 as ASCII characters and other values as numbers on their own line")
+	flag.Var(patchFlag{patches: &memoryPatches}, "set", "Patch the memory before the execution by '<address>=<value>' "+
+		"or '<address>=<value1>,<value2>,...' for consecutive addresses. Can be repeated")
+	flag.Var(patchFlag{patches: &memoryPatches, load: true}, "load", "Load the ints of a file into the memory before "+
+		"the execution by '<address>=<file>'. The file is parsed like a program. Can be repeated")
 	flag.UintVar(&additionalMemory, "mem", 42, "Number of ints that are allocated for the memory in addition "+
 		"to the program. If a memory address outside the allocated memory is requested, the memory is increased by that offset")
 	flag.Parse()
+	if statsFilename != "" {
+		showStats = true
+	}
+	if _, ok := statsFormats[statsFormat]; !ok {
+		fmt.Fprintf(flag.CommandLine.Output(), "invalid value %q for flag -stats-format: unknown stats format\n", statsFormat)
+		flag.Usage()
+		os.Exit(2)
+	}
 }
 
 // printInfo prints the version number and help for this intcode interpreter.
@@ -15,3 +15,21 @@ func (ints ints) String() string {
 	}
 	return strings.Join(intsStr, ",")
 }
+
+// parseInts parses a comma separated string of int64s, as created by
+// ints.String. An empty string results in an empty ints.
+func parseInts(str string) (ints, error) {
+	if str == "" {
+		return ints{}, nil
+	}
+	intsStrArr := strings.Split(str, ",")
+	intsArr := make(ints, len(intsStrArr))
+	for i, v := range intsStrArr {
+		var err error
+		intsArr[i], err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return intsArr, nil
+}
@@ -11,3 +11,14 @@ func TestInts_String(t *testing.T) {
 	i = []int64{1, 2, 3, 5}
 	assert.Equal(t, "1,2,3,5", i.String())
 }
+
+func TestParseInts(t *testing.T) {
+	i, err := parseInts("")
+	assert.NoError(t, err)
+	assert.Equal(t, ints{}, i)
+	i, err = parseInts("1,2,-3,5")
+	assert.NoError(t, err)
+	assert.Equal(t, ints{1, 2, -3, 5}, i)
+	_, err = parseInts("1,a")
+	assert.Error(t, err)
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// InputSource provides the input values of a program.
+type InputSource interface {
+	// ReadInput returns the next input value, or io.EOF if there is none.
+	ReadInput() (int64, error)
+	// Pending reads ahead the input values, which are available without
+	// waiting for more input, e.g. the rest of a file but not of stdin, and
+	// returns them. ReadInput still returns them afterwards. complete reports
+	// whether the input has ended after them.
+	Pending() (values ints, complete bool)
+}
+
+// OutputSink receives the output values of a program.
+type OutputSink interface {
+	WriteOutput(value int64) error
+}
+
+// numberInput reads input values as whitespace separated numbers.
+type numberInput struct {
+	r io.Reader
+	// prompt is where an input message is printed before reading, or nil.
+	prompt io.Writer
+	// prompted indicates whether the input message has been printed for the
+	// next value, which is not repeated while waiting for more input.
+	prompted bool
+	// ahead are the values read ahead by Pending.
+	ahead valuesInput
+}
+
+// NewNumberInput returns an input source reading whitespace separated numbers
+// from r, like Input does without an input source.
+func NewNumberInput(r io.Reader) InputSource {
+	return &numberInput{r: r}
+}
+
+func (in *numberInput) ReadInput() (int64, error) {
+	if len(in.ahead.values) > 0 {
+		return in.ahead.ReadInput()
+	}
+	return in.read()
+}
+
+func (in *numberInput) Pending() (ints, bool) {
+	if !canReadAll(in.r) {
+		values, _ := in.ahead.Pending()
+		return values, false
+	}
+	return readAhead(&in.ahead, in.read)
+}
+
+// read reads the next number from r.
+func (in *numberInput) read() (int64, error) {
+	if in.prompt != nil && !in.prompted {
+		fmt.Fprint(in.prompt, "Input: ")
+		in.prompted = true
+	}
+	var value int64
+	// Newlines are whitespace like spaces, so that trailing whitespace ends
+	// the input with io.EOF
+	_, err := fmt.Fscan(in.r, &value)
+	if err == nil {
+		in.prompted = false
+	}
+	return value, err
+}
+
+// asciiInput reads input values as characters.
+type asciiInput struct {
+	src io.Reader
+	r   *bufio.Reader
+	// lineStart indicates whether the next character starts a new line.
+	lineStart bool
+	// unterminated indicates whether the last line is not terminated at the
+	// end of r, because more input may follow.
+	unterminated bool
+	// ahead are the values read ahead by Pending.
+	ahead valuesInput
+}
+
+// NewASCIIInput returns an input source, which reads the characters of the
+// lines of r as their ASCII codes. Every line ends with a newline, even the
+// last one, and carriage returns are skipped.
+func NewASCIIInput(r io.Reader) InputSource {
+	return &asciiInput{src: r, r: bufio.NewReader(r), lineStart: true}
+}
+
+func (in *asciiInput) ReadInput() (int64, error) {
+	if len(in.ahead.values) > 0 {
+		return in.ahead.ReadInput()
+	}
+	return in.read()
+}
+
+func (in *asciiInput) Pending() (ints, bool) {
+	if !canReadAll(in.src) {
+		values, _ := in.ahead.Pending()
+		return values, false
+	}
+	return readAhead(&in.ahead, in.read)
+}
+
+// read reads the next character from r.
+func (in *asciiInput) read() (int64, error) {
+	for {
+		c, err := in.r.ReadByte()
+		if err == io.EOF && !in.lineStart && !in.unterminated {
+			// Terminate the last line
+			c, err = '\n', nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c == '\r' {
+			continue
+		}
+		in.lineStart = c == '\n'
+		return int64(c), nil
+	}
+}
+
+// asciiOutput writes output values as characters.
+type asciiOutput struct {
+	w io.Writer
+	// lineStart indicates whether the next character starts a new line.
+	lineStart bool
+	buf       [24]byte
+}
+
+// NewASCIIOutput returns an output sink, which writes the values 0 to 127 as
+// ASCII characters to w. Other values are written as numbers on their own line.
+func NewASCIIOutput(w io.Writer) OutputSink {
+	return &asciiOutput{w: w, lineStart: true}
+}
+
+func (out *asciiOutput) WriteOutput(value int64) error {
+	if value >= 0 && value <= 127 {
+		out.buf[0] = byte(value)
+		out.lineStart = value == '\n'
+		_, err := out.w.Write(out.buf[:1])
+		return err
+	}
+	line := out.buf[:0]
+	if !out.lineStart {
+		line = append(line, '\n')
+	}
+	line = append(strconv.AppendInt(line, value, 10), '\n')
+	out.lineStart = true
+	_, err := out.w.Write(line)
+	return err
+}
+
+// valuesInput provides fixed input values.
+type valuesInput struct {
+	values ints
+}
+
+// NewValuesInput returns an input source providing the values in their order.
+func NewValuesInput(values ...int64) InputSource {
+	return &valuesInput{values: values}
+}
+
+func (in *valuesInput) ReadInput() (int64, error) {
+	if len(in.values) == 0 {
+		return 0, io.EOF
+	}
+	value := in.values[0]
+	in.values = in.values[1:]
+	return value, nil
+}
+
+func (in *valuesInput) Pending() (ints, bool) {
+	return append(ints{}, in.values...), true
+}
+
+// readAhead appends the values returned by read to ahead until an error, and
+// returns all values of ahead. The values are complete, if read has ended with
+// io.EOF.
+func readAhead(ahead *valuesInput, read func() (int64, error)) (ints, bool) {
+	for {
+		value, err := read()
+		if err != nil {
+			values, _ := ahead.Pending()
+			return values, err == io.EOF
+		}
+		ahead.values = append(ahead.values, value)
+	}
+}
+
+// canReadAll reports whether the rest of r can be read without waiting for
+// more input. This holds for in-memory readers and regular files, but not for
+// stdin, pipes and sockets.
+func canReadAll(r io.Reader) bool {
+	if r == nil || r == os.Stdin {
+		return false
+	}
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return false
+	}
+	_, err := seeker.Seek(0, io.SeekCurrent)
+	return err == nil
+}
+
+// chainInput reads the input sources one after another.
+type chainInput struct {
+	sources []InputSource
+}
+
+// NewChainInput returns an input source, which reads from each source until
+// its end. The end of the last source is the end of the chain, and it is read
+// again on further reads, e.g. after more input has been appended to a file.
+func NewChainInput(sources ...InputSource) InputSource {
+	if len(sources) == 1 {
+		return sources[0]
+	}
+	return &chainInput{sources: sources}
+}
+
+func (in *chainInput) ReadInput() (int64, error) {
+	for {
+		if len(in.sources) == 0 {
+			return 0, io.EOF
+		}
+		value, err := in.sources[0].ReadInput()
+		if err != io.EOF || len(in.sources) == 1 {
+			return value, err
+		}
+		in.sources = in.sources[1:]
+	}
+}
+
+func (in *chainInput) Pending() (ints, bool) {
+	pending := ints{}
+	for _, source := range in.sources {
+		values, complete := source.Pending()
+		pending = append(pending, values...)
+		if !complete {
+			return pending, false
+		}
+	}
+	return pending, true
+}
+
+// EOFAction is what happens, when a program reads beyond the end of its input.
+type EOFAction int
+
+const (
+	// EOFError crashes the program with io.EOF.
+	EOFError EOFAction = iota
+	// EOFHalt finishes the program at the input instruction.
+	EOFHalt
+	// EOFBlock waits for more input.
+	EOFBlock
+	// EOFSentinel reads EOFPolicy.Sentinel.
+	EOFSentinel
+)
+
+// eofActionNames are the names of the EOF actions besides EOFSentinel.
+var eofActionNames = map[EOFAction]string{
+	EOFError: "error",
+	EOFHalt:  "halt",
+	EOFBlock: "block",
+}
+
+// EOFPolicy defines the reaction to reading beyond the end of the input. The
+// zero value crashes the program.
+type EOFPolicy struct {
+	Action EOFAction
+	// Sentinel is the input value read by EOFSentinel.
+	Sentinel int64
+}
+
+// ParseEOFPolicy parses "error", "halt", "block", or an int literal, which is
+// read as a sentinel value.
+func ParseEOFPolicy(str string) (EOFPolicy, error) {
+	for action, name := range eofActionNames {
+		if str == name {
+			return EOFPolicy{Action: action}, nil
+		}
+	}
+	sentinel, err := parseLiteral([]byte(str))
+	if err != nil {
+		return EOFPolicy{}, fmt.Errorf("invalid EOF policy %q: neither error, halt, block nor an int", str)
+	}
+	return EOFPolicy{Action: EOFSentinel, Sentinel: sentinel}, nil
+}
+
+func (e EOFPolicy) String() string {
+	if e.Action == EOFSentinel {
+		return strconv.FormatInt(e.Sentinel, 10)
+	}
+	return eofActionNames[e.Action]
+}
+
+// Set implements flag.Value.
+func (e *EOFPolicy) Set(str string) error {
+	policy, err := ParseEOFPolicy(str)
+	if err != nil {
+		return err
+	}
+	*e = policy
+	return nil
+}
+
+func (e EOFPolicy) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+func (e *EOFPolicy) UnmarshalText(text []byte) error {
+	return e.Set(string(text))
+}
+
+// inputSpec is an input source given on the command line, either inline
+// values or a file, where "-" is stdin.
+type inputSpec struct {
+	Values   ints   `json:"values,omitempty"`
+	Filename string `json:"file,omitempty"`
+}
+
+// inputFlag is a repeatable flag of input sources, which keeps the order of
+// inline values and files.
+type inputFlag struct {
+	specs *[]inputSpec
+	// values indicates whether the flag are comma separated values instead of
+	// a file.
+	values bool
+}
+
+func (f inputFlag) String() string {
+	if f.specs == nil {
+		return ""
+	}
+	var specs []string
+	for _, spec := range *f.specs {
+		if spec.Filename != "" {
+			specs = append(specs, spec.Filename)
+		} else {
+			specs = append(specs, spec.Values.String())
+		}
+	}
+	return strings.Join(specs, " ")
+}
+
+func (f inputFlag) Set(str string) error {
+	if !f.values {
+		if str == "" {
+			return errors.New("empty file name")
+		}
+		*f.specs = append(*f.specs, inputSpec{Filename: str})
+		return nil
+	}
+	var values ints
+	for _, value := range strings.Split(str, ",") {
+		v, err := parseLiteral([]byte(strings.TrimSpace(value)))
+		if err != nil {
+			return fmt.Errorf("invalid input value %q: %w", value, err)
+		}
+		values = append(values, v)
+	}
+	*f.specs = append(*f.specs, inputSpec{Values: values})
+	return nil
+}
+
+// openInputs opens the input sources of specs and chains them in their order.
+// Without specs, stdin is read. Files are read as ASCII characters if ascii is
+// set, while inline values are always read as they are. If block is set, the
+// last source is waited for at its end, so that its last line is not
+// terminated. Stdin prompts for numbers on prompt. The opened files are
+// returned to be closed.
+func openInputs(specs []inputSpec, ascii bool, block bool, prompt io.Writer) (InputSource, []*os.File, error) {
+	if len(specs) == 0 {
+		specs = []inputSpec{{Filename: "-"}}
+	}
+	var sources []InputSource
+	var files []*os.File
+	for i, spec := range specs {
+		if spec.Filename == "" {
+			sources = append(sources, NewValuesInput(spec.Values...))
+			continue
+		}
+		file := os.Stdin
+		if spec.Filename != "-" {
+			var err error
+			if file, err = os.Open(spec.Filename); err != nil {
+				closeFiles(files)
+				return nil, nil, err
+			}
+			files = append(files, file)
+		}
+		switch {
+		case ascii:
+			in := NewASCIIInput(file).(*asciiInput)
+			// The last line of the last source may be continued while waiting
+			in.unterminated = block && i == len(specs)-1
+			sources = append(sources, in)
+		case file == os.Stdin:
+			sources = append(sources, &numberInput{r: file, prompt: prompt})
+		default:
+			sources = append(sources, NewNumberInput(file))
+		}
+	}
+	return NewChainInput(sources...), files, nil
+}
+
+// closeFiles closes the files.
+func closeFiles(files []*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readInputs reads all values of in until an error.
+func readInputs(in InputSource) (ints, error) {
+	values := ints{}
+	for {
+		value, err := in.ReadInput()
+		if err != nil {
+			return values, err
+		}
+		values = append(values, value)
+	}
+}
+
+func TestNumberInput(t *testing.T) {
+	for _, input := range []string{"1 -2 3", "1\n-2\n3\n", "1 -2 3 \n", "1\n-2\n3\n\n", "\t1\r\n -2 3\r\n"} {
+		values, err := readInputs(NewNumberInput(strings.NewReader(input)))
+		assert.Equal(t, io.EOF, err, input)
+		assert.Equal(t, ints{1, -2, 3}, values, input)
+	}
+
+	_, err := readInputs(NewNumberInput(strings.NewReader("1 x")))
+	assert.EqualError(t, err, "expected integer")
+}
+
+func TestASCIIInput(t *testing.T) {
+	for input, expected := range map[string]ints{
+		"":           {},
+		"ab\ncd":     {'a', 'b', '\n', 'c', 'd', '\n'},
+		"ab\n":       {'a', 'b', '\n'},
+		"a\r\nb\r\n": {'a', '\n', 'b', '\n'},
+		"\n\n":       {'\n', '\n'},
+	} {
+		values, err := readInputs(NewASCIIInput(strings.NewReader(input)))
+		assert.Equal(t, io.EOF, err, input)
+		assert.Equal(t, expected, values, input)
+	}
+}
+
+func TestASCIIOutput(t *testing.T) {
+	for _, test := range []struct {
+		values   ints
+		expected string
+	}{
+		{ints{'H', 'i', '\n', 1000}, "Hi\n1000\n"},
+		{ints{'a', 300, 'b'}, "a\n300\nb"},
+		{ints{-1, 128, 0}, "-1\n128\n\x00"},
+	} {
+		var output strings.Builder
+		out := NewASCIIOutput(&output)
+		for _, value := range test.values {
+			assert.NoError(t, out.WriteOutput(value))
+		}
+		assert.Equal(t, test.expected, output.String())
+	}
+}
+
+func TestProgram_ASCII(t *testing.T) {
+	// Echo the input until a newline, then output 1000
+	p := New("3,20,4,20,1008,20,10,21,1006,21,0,104,1000,99", 10)
+	p.InputSource = NewASCIIInput(strings.NewReader("hello"))
+	var output strings.Builder
+	p.OutputWriter = &output
+	p.OutputSink = NewASCIIOutput(p.OutputWriter)
+	p.Exec()
+	assert.Equal(t, "hello\n1000\n", output.String())
+	assert.Equal(t, 6, p.Inputs)
+	assert.Equal(t, 7, p.Outputs)
+}
+
+func TestChainInput(t *testing.T) {
+	in := NewChainInput(NewValuesInput(1, 5), NewNumberInput(strings.NewReader("\n")), NewValuesInput(),
+		NewNumberInput(strings.NewReader("42\n-1 \n\n")))
+	values, err := readInputs(in)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, ints{1, 5, 42, -1}, values)
+
+	// The end of the last source is read again
+	file := &strings.Builder{}
+	last := readerFunc(func(b []byte) (int, error) {
+		if file.Len() == 0 {
+			return 0, io.EOF
+		}
+		n := copy(b, file.String())
+		file.Reset()
+		return n, nil
+	})
+	in = NewChainInput(NewValuesInput(1), NewNumberInput(last))
+	values, err = readInputs(in)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, ints{1}, values)
+	file.WriteString("7 ")
+	value, err := in.ReadInput()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), value)
+}
+
+func TestParseEOFPolicy(t *testing.T) {
+	for str, expected := range map[string]EOFPolicy{
+		"error": {},
+		"halt":  {Action: EOFHalt},
+		"block": {Action: EOFBlock},
+		"-1":    {Action: EOFSentinel, Sentinel: -1},
+		"0x10":  {Action: EOFSentinel, Sentinel: 16},
+	} {
+		policy, err := ParseEOFPolicy(str)
+		assert.NoError(t, err, str)
+		assert.Equal(t, expected, policy, str)
+	}
+	assert.Equal(t, "16", EOFPolicy{Action: EOFSentinel, Sentinel: 16}.String())
+
+	_, err := ParseEOFPolicy("stop")
+	assert.EqualError(t, err, `invalid EOF policy "stop": neither error, halt, block nor an int`)
+}
+
+func TestInput_EOF(t *testing.T) {
+	// Sum the input values until the input is 0
+	const sum = "3,20,1006,20,12,1,20,21,21,1105,1,0,4,21,99"
+	exec := func(policy EOFPolicy, stats bool) (*Program, string) {
+		p := New(sum, 10)
+		if stats {
+			p.Stats = NewStats()
+		}
+		p.InputSource = NewValuesInput(1, 2, 3)
+		p.EOF = policy
+		out := &strings.Builder{}
+		p.OutputWriter = out
+		p.Exec()
+		return p, out.String()
+	}
+
+	for _, stats := range []bool{false, true} {
+		assert.PanicsWithError(t, "EOF", func() { exec(EOFPolicy{}, stats) })
+
+		// Halt at the input instruction
+		p, out := exec(EOFPolicy{Action: EOFHalt}, stats)
+		assert.Equal(t, "", out)
+		assert.True(t, p.Finish)
+		assert.Equal(t, 0, p.IP)
+		assert.Equal(t, int64(6), p.Ints[21])
+		assert.Equal(t, 3, p.Inputs)
+
+		p, out = exec(EOFPolicy{Action: EOFSentinel}, stats)
+		assert.Equal(t, "6\n", out)
+		assert.Equal(t, 4, p.Inputs)
+	}
+
+	// Trailing whitespace of the input reader ends the input
+	p := New(sum, 10)
+	p.InputReader = strings.NewReader("1 2 3 \n\n")
+	p.EOF = EOFPolicy{Action: EOFSentinel}
+	out := &strings.Builder{}
+	p.OutputWriter = out
+	p.Exec()
+	assert.Equal(t, "6\n", out.String())
+}
+
+func TestInput_EOFBlock(t *testing.T) {
+	// Output the input values until the input is 0
+	p := New("3,20,1006,20,10,4,20,1105,1,0,99", 10)
+	var mutex sync.Mutex
+	pending := "1 "
+	p.InputReader = readerFunc(func(b []byte) (int, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if pending == "" {
+			return 0, io.EOF
+		}
+		n := copy(b, pending)
+		pending = pending[n:]
+		return n, nil
+	})
+	p.EOF = EOFPolicy{Action: EOFBlock}
+	out := &strings.Builder{}
+	p.OutputWriter = out
+	go func() {
+		time.Sleep(2 * inputPollInterval)
+		mutex.Lock()
+		pending = "2 0"
+		mutex.Unlock()
+	}()
+	p.Exec()
+	assert.Equal(t, "1\n2\n", out.String())
+}
+
+func TestInputFlag(t *testing.T) {
+	var specs []inputSpec
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Var(inputFlag{specs: &specs}, "input", "")
+	fs.Var(inputFlag{specs: &specs, values: true}, "in", "")
+	assert.NoError(t, fs.Parse([]string{"-in", "1, 5,0x2A", "-input", "data.txt", "-in", "-1", "-input", "-"}))
+	assert.Equal(t, []inputSpec{
+		{Values: ints{1, 5, 42}},
+		{Filename: "data.txt"},
+		{Values: ints{-1}},
+		{Filename: "-"},
+	}, specs)
+	assert.Equal(t, "1,5,42 data.txt -1 -", inputFlag{specs: &specs}.String())
+
+	assert.Error(t, fs.Parse([]string{"-in", "1,x"}))
+	assert.Error(t, fs.Parse([]string{"-in", ""}))
+	assert.Error(t, fs.Parse([]string{"-input", ""}))
+}
+
+func TestOpenInputs(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "input")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("3 4 \n\n"), 0664))
+
+	in, files, err := openInputs([]inputSpec{{Values: ints{1, 2}}, {Filename: filename}, {Values: ints{5}}}, false, false, nil)
+	assert.NoError(t, err)
+	defer closeFiles(files)
+	assert.Len(t, files, 1)
+	values, err := readInputs(in)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, ints{1, 2, 3, 4, 5}, values)
+
+	// Inline values are not characters
+	in, files, err = openInputs([]inputSpec{{Values: ints{1}}, {Filename: filename}}, true, false, nil)
+	assert.NoError(t, err)
+	defer closeFiles(files)
+	values, _ = readInputs(in)
+	assert.Equal(t, ints{1, '3', ' ', '4', ' ', '\n', '\n'}, values)
+
+	_, _, err = openInputs([]inputSpec{{Filename: filename}, {Filename: filename + ".missing"}}, false, false, nil)
+	assert.Error(t, err)
+}
+
+func TestOpenInputs_ASCIIBlock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "input")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("ab"), 0664))
+
+	// The last line is continued by the input appended while waiting
+	in, files, err := openInputs([]inputSpec{{Filename: filename}}, true, true, nil)
+	assert.NoError(t, err)
+	defer closeFiles(files)
+	values, err := readInputs(in)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, ints{'a', 'b'}, values)
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0664)
+	assert.NoError(t, err)
+	_, err = file.WriteString("c\n")
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	values, _ = readInputs(in)
+	assert.Equal(t, ints{'c', '\n'}, values)
+}
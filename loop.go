@@ -0,0 +1,194 @@
+package main
+
+import "fmt"
+
+// loopPageSize is the number of ints of the memory pages, whose hashes are
+// updated if they have been written since the last check.
+const loopPageSize = 256
+
+// LoopError is the error a program panics with, if it is stuck in an infinite
+// loop without input or output.
+type LoopError struct {
+	// Start and End are the first and last address of the instructions of the
+	// loop.
+	Start, End int
+	// Period is the number of instructions of an iteration of the loop.
+	Period int
+	// Step is the number of executed instructions before the first iteration,
+	// which has been detected.
+	Step int
+}
+
+func (e *LoopError) Error() string {
+	return fmt.Sprintf("infinite loop at addresses %d-%d with a period of %d instructions after %d instructions",
+		e.Start, e.End, e.Period, e.Step)
+}
+
+// loopDetector detects infinite loops by hashing the state of the program,
+// i.e. the IP, the relative base and the memory, every Interval instructions.
+// The memory is hashed by pages, and only the pages written since the last
+// check are hashed again. The states are compared by Brent's algorithm, which
+// is reset by every input and output, and by every timestamp and random number,
+// whose values depend on the environment like an input. If a state repeats, the loop is
+// confirmed by hashing the state at every execution of its first instruction
+// until it repeats again.
+type loopDetector struct {
+	Interval int
+	interval stepInterval
+	// pageHashes are the hashes of the memory pages, and memoryHash combines
+	// them.
+	pageHashes []uint64
+	memoryHash uint64
+	memoryLen  int
+	dirty      []bool
+	// io is the number of inputs, outputs and external instructions at the
+	// last check.
+	io int
+	// externals is the number of executed timestamp and random instructions.
+	externals int
+	// tortoise is the state hash compared with, which is replaced when
+	// checks reaches power.
+	tortoise     uint64
+	tortoiseStep int
+	hasTortoise  bool
+	checks       int
+	power        int
+	// confirming is set while the loop starting at loop is confirmed.
+	confirming bool
+	loop       LoopError
+	loopIP     int
+	loopHash   uint64
+	// maxPeriod is the number of steps between the compared checks, which is
+	// a multiple of the period.
+	maxPeriod int
+}
+
+// newLoopDetector creates a loop detector checking every interval
+// instructions.
+func newLoopDetector(interval int) *loopDetector {
+	return &loopDetector{Interval: interval, power: 1}
+}
+
+// write records a write to the memory at index.
+func (d *loopDetector) write(index int) {
+	if page := index / loopPageSize; page < len(d.dirty) {
+		d.dirty[page] = true
+	}
+}
+
+// external records the execution of an instruction, whose result depends on
+// the environment.
+func (d *loopDetector) external() {
+	d.externals++
+}
+
+// ioCount returns the number of inputs, outputs and external instructions.
+func (d *loopDetector) ioCount(p *Program) int {
+	return p.Inputs + p.Outputs + d.externals
+}
+
+// execute checks the state before the execution of the instruction at p.IP,
+// if a check is due. It panics with a LoopError, if a loop is confirmed.
+func (d *loopDetector) execute(p *Program) {
+	if d.confirming {
+		d.confirm(p)
+		return
+	}
+	if !d.interval.due(p.Steps, d.Interval) {
+		return
+	}
+	if io := d.ioCount(p); io != d.io {
+		d.io = io
+		d.hasTortoise = false
+	}
+	hash := d.stateHash(p)
+	if d.hasTortoise && hash == d.tortoise {
+		d.confirming = true
+		d.loop = LoopError{Start: p.IP, End: p.IP, Step: p.Steps}
+		d.loopIP = p.IP
+		d.loopHash = hash
+		d.maxPeriod = p.Steps - d.tortoiseStep
+		return
+	}
+	d.checks++
+	if !d.hasTortoise || d.checks == d.power {
+		if d.hasTortoise {
+			d.power *= 2
+		} else {
+			d.power = 1
+		}
+		d.tortoise = hash
+		d.tortoiseStep = p.Steps
+		d.hasTortoise = true
+		d.checks = 0
+	}
+}
+
+// confirm records the address range of the loop and compares the state with
+// the state at its start, whenever the first instruction of the loop is
+// executed again. If the state does not repeat within maxPeriod steps, the
+// hashes have collided and the detection continues.
+func (d *loopDetector) confirm(p *Program) {
+	if d.ioCount(p) != d.io || p.Steps-d.loop.Step > d.maxPeriod {
+		d.confirming = false
+		d.hasTortoise = false
+		return
+	}
+	end := p.IP
+	if raw := p.Ints[p.IP]; raw >= 0 && int(newOpcode(raw)) < len(opcodes) {
+		end += opcodes[newOpcode(raw)].ArgNum
+	}
+	if p.IP < d.loop.Start {
+		d.loop.Start = p.IP
+	}
+	if end > d.loop.End {
+		d.loop.End = end
+	}
+	if p.IP != d.loopIP || p.Steps == d.loop.Step || d.stateHash(p) != d.loopHash {
+		return
+	}
+	d.loop.Period = p.Steps - d.loop.Step
+	err := d.loop
+	panic(&err)
+}
+
+// stateHash returns the hash of the IP, the relative base and the memory.
+func (d *loopDetector) stateHash(p *Program) uint64 {
+	pages := (len(p.Ints) + loopPageSize - 1) / loopPageSize
+	if len(p.Ints) != d.memoryLen && len(d.dirty) > 0 {
+		// The last page has grown
+		d.dirty[len(d.dirty)-1] = true
+	}
+	d.memoryLen = len(p.Ints)
+	for len(d.pageHashes) < pages {
+		// Hash the new pages of the grown memory
+		d.pageHashes = append(d.pageHashes, 0)
+		d.dirty = append(d.dirty, true)
+	}
+	for i := 0; i < pages; i++ {
+		if !d.dirty[i] {
+			continue
+		}
+		d.dirty[i] = false
+		end := (i + 1) * loopPageSize
+		if end > len(p.Ints) {
+			end = len(p.Ints)
+		}
+		hash := hashInts(uint64(i), p.Ints[i*loopPageSize:end])
+		d.memoryHash ^= d.pageHashes[i] ^ hash
+		d.pageHashes[i] = hash
+	}
+	registers := [...]int64{int64(p.IP), p.RelBase, int64(len(p.Ints))}
+	return hashInts(d.memoryHash, registers[:])
+}
+
+// hashInts returns a hash of the values starting with seed, which is computed
+// like FNV-1a, but by ints instead of bytes.
+func hashInts(seed uint64, values ints) uint64 {
+	const prime = 1099511628211
+	hash := (14695981039346656037 ^ seed) * prime
+	for _, v := range values {
+		hash = (hash ^ uint64(v)) * prime
+	}
+	return hash
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// execLoop executes the program with a loop detector checking every interval
+// instructions, in the fast and in the instrumented loop, and returns the
+// detected loop, or nil if the program has finished.
+func execLoop(t *testing.T, source string, input string, interval int) *LoopError {
+	var loops []*LoopError
+	for _, stats := range []bool{false, true} {
+		p := New(source, 10)
+		if stats {
+			p.Stats = NewStats()
+		}
+		p.InputReader = strings.NewReader(input)
+		p.OutputWriter = &strings.Builder{}
+		p.Loop = newLoopDetector(interval)
+		err := p.execRecover()
+		if err == nil {
+			loops = append(loops, nil)
+			continue
+		}
+		loopErr, ok := err.(*LoopError)
+		assert.True(t, ok, err.Error())
+		loops = append(loops, loopErr)
+	}
+	assert.Equal(t, loops[0], loops[1])
+	return loops[0]
+}
+
+func TestLoopDetector(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		source   string
+		input    string
+		expected *LoopError
+	}{
+		{
+			name: "spin",
+			// Jump to itself
+			source:   "1105,1,0",
+			expected: &LoopError{Start: 0, End: 2, Period: 1, Step: 15},
+		},
+		{
+			name: "wait",
+			// Wait for [20] to become non-zero, which it never does
+			source:   "1101,0,0,20,1005,20,0,1105,1,4",
+			expected: &LoopError{Start: 4, End: 9, Period: 2, Step: 15},
+		},
+		{
+			name: "toggle",
+			// Toggle [20] between 0 and 1 forever
+			source:   "1008,20,0,20,1105,1,0",
+			expected: &LoopError{Start: 0, End: 6, Period: 4, Step: 15},
+		},
+		{
+			name: "relative base",
+			// Increase and decrease the relative base
+			source:   "109,5,109,-5,1105,1,0",
+			expected: &LoopError{Start: 0, End: 6, Period: 3, Step: 55},
+		},
+		{
+			name:   "count",
+			source: countLoop,
+		},
+		{
+			name: "input",
+			// Read the input until it is 0
+			source: "3,20,1005,20,0,99",
+			input:  strings.Repeat("1 ", 200) + "0",
+		},
+		{
+			name: "grow",
+			// Write to increasing addresses until address 2000
+			source: "21101,1,0,0,109,1,1207,0,2000,30,1005,30,0,99",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, execLoop(t, test.source, test.input, 8))
+		})
+	}
+}
+
+func TestLoopDetector_Timestamp(t *testing.T) {
+	// Polls the timestamp until the next second, which repeats the state
+	// without input or output
+	target := time.Now().Unix() + 1
+	poll := "18,10,7,10,11,12,1005,12,0,99,0," + strconv.FormatInt(target, 10)
+	assert.Nil(t, execLoop(t, poll, "", 100))
+}
+
+func TestLoopError_Error(t *testing.T) {
+	err := &LoopError{Start: 4, End: 9, Period: 2, Step: 199}
+	assert.Equal(t, "infinite loop at addresses 4-9 with a period of 2 instructions after 199 instructions", err.Error())
+}
+
+func BenchmarkLoopDetector(b *testing.B) {
+	template := New(countLoop, 10)
+	for _, interval := range []int{0, 1000, 10000} {
+		name := "off"
+		if interval > 0 {
+			name = "every-" + strconv.Itoa(interval)
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				p := New("99", 0)
+				p.Ints = append(ints{}, template.Ints...)
+				p.OutputWriter = &strings.Builder{}
+				if interval > 0 {
+					p.Loop = newLoopDetector(interval)
+				}
+				p.Exec()
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// memoryChange is a range of consecutive addresses whose values have changed.
+type memoryChange struct {
+	// Start is the first changed address.
+	Start int
+	// End is the last changed address.
+	End int
+	// Old are the values before the change.
+	Old ints
+	// New are the values after the change.
+	New ints
+	// Code indicates whether the range is inside the code region, i.e. the
+	// program has modified itself.
+	Code bool
+}
+
+func (c memoryChange) String() string {
+	addresses := fmt.Sprint(c.Start)
+	if c.End != c.Start {
+		addresses += fmt.Sprintf("..%d", c.End)
+	}
+	region := ""
+	if c.Code {
+		region = "code"
+	}
+	return fmt.Sprintf("%-12s %-4s %s -> %s", addresses, region, c.Old.String(), c.New.String())
+}
+
+// diffMemoryRanges compares the memory before and after the execution and
+// groups the changed addresses into ranges. A range does not cross the end of
+// the code region, which ends before codeLen.
+func diffMemoryRanges(before, after ints, codeLen int) []memoryChange {
+	var changes []memoryChange
+	for _, address := range diffMemory(before, after) {
+		code := address < codeLen
+		last := len(changes) - 1
+		if last < 0 || changes[last].End+1 != address || changes[last].Code != code {
+			changes = append(changes, memoryChange{Start: address, Code: code})
+			last++
+		}
+		changes[last].End = address
+		changes[last].Old = append(changes[last].Old, memoryValue(before, address))
+		changes[last].New = append(changes[last].New, memoryValue(after, address))
+	}
+	return changes
+}
+
+// printMemoryChanges writes a report of the changes to w.
+func printMemoryChanges(w io.Writer, changes []memoryChange) {
+	addresses, codeAddresses := 0, 0
+	for _, c := range changes {
+		addresses += c.End - c.Start + 1
+		if c.Code {
+			codeAddresses += c.End - c.Start + 1
+		}
+	}
+	fmt.Fprintf(w, "Changed %d addresses in %d ranges (%d in code region):\n", addresses, len(changes), codeAddresses)
+	for _, c := range changes {
+		fmt.Fprintln(w, " ", c.String())
+	}
+}
+
+// memDiffCommand compares a program with its executed memory. The executed
+// memory is either read from a file written by -executed-program, or the
+// program is run to get it.
+func memDiffCommand(args []string) {
+	fs := flag.NewFlagSet("memdiff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s memdiff <flags> <program> [<executed program>]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	input := fs.String("input", "", "File to read input values from, if the program is run")
+	fs.Parse(args)
+	if fs.NArg() != 1 && fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	p, closeInput := loadProgram(fs.Arg(0), *input)
+	defer closeInput()
+	before := make(ints, len(p.Ints))
+	copy(before, p.Ints)
+
+	var after ints
+	if fs.NArg() == 2 {
+		executed, err := ioutil.ReadFile(fs.Arg(1))
+		if err != nil {
+			panic(err)
+		}
+		after, err = parseInts(strings.TrimSpace(string(executed)))
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		p.OutputWriter = ioutil.Discard
+		p.Exec()
+		after = p.Ints
+	}
+	printMemoryChanges(os.Stdout, diffMemoryRanges(before, after, p.CodeLen))
+}
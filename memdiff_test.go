@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDiffMemoryRanges(t *testing.T) {
+	before := ints{1, 2, 3, 4, 5, 0, 0, 0}
+	after := ints{1, 9, 3, 8, 9, 7, 0, 6, 5}
+	assert.Equal(t, []memoryChange{
+		{Start: 1, End: 1, Old: ints{2}, New: ints{9}, Code: true},
+		{Start: 3, End: 4, Old: ints{4, 5}, New: ints{8, 9}, Code: true},
+		{Start: 5, End: 5, Old: ints{0}, New: ints{7}, Code: false},
+		{Start: 7, End: 8, Old: ints{0, 0}, New: ints{6, 5}, Code: false},
+	}, diffMemoryRanges(before, after, 5))
+}
+
+func TestPrintMemoryChanges(t *testing.T) {
+	var out bytes.Buffer
+	printMemoryChanges(&out, diffMemoryRanges(ints{1, 2, 0, 0}, ints{1, 3, 4, 5}, 2))
+	assert.Equal(t, "Changed 3 addresses in 2 ranges (1 in code region):\n"+
+		"  1            code 2 -> 3\n"+
+		"  2..3              0,0 -> 4,5\n", out.String())
+}
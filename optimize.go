@@ -0,0 +1,86 @@
+package main
+
+// Superinstructions are internal opcodes of the fast dispatch loop, into which
+// the optimizer turns idioms and sequences of instructions.
+const (
+	// superMove copies a value, e.g. by adding 0 or multiplying by 1.
+	superMove opcode = 100 + iota
+	// superJump jumps unconditionally, e.g. by jumping if 1 is non-zero.
+	superJump
+	// superCompareJump is a less than or equal instruction followed by a jump
+	// on its result.
+	superCompareJump
+)
+
+// superinstructionNames are the names of the superinstructions in the stats.
+var superinstructionNames = [...]string{
+	superMove - superMove:        "move",
+	superJump - superMove:        "jump",
+	superCompareJump - superMove: "compare-jump",
+}
+
+// maxSuperinstructionSize is the number of ints of the longest superinstruction,
+// i.e. a compare followed by a jump.
+const maxSuperinstructionSize = 7
+
+// optimize turns the decoded instruction d at address into a superinstruction,
+// if it is an idiom or the start of a sequence, which can be fused.
+func (p *Program) optimize(address int, d *decodedInstruction) {
+	arg := func(i int) int64 {
+		return p.Ints[address+1+i]
+	}
+	switch d.op {
+	case 1, 2:
+		// Adding 0 or multiplying by 1 copies the other operand
+		neutral := int64(d.op - 1)
+		for i := 0; i < 2; i++ {
+			if d.modes[i] == 1 && arg(i) == neutral {
+				d.op = superMove
+				d.moveFrom = uint8(1 - i)
+				return
+			}
+		}
+	case 5, 6:
+		if d.modes[0] == 1 && (arg(0) != 0) == (d.op == 5) {
+			d.op = superJump
+		}
+	case 7, 8:
+		// The jump has to read the result of the compare by the same mode and
+		// argument
+		jump := address + 4
+		if jump+2 >= len(p.Ints) || p.Ints[jump] < 0 || d.modes[2] == 1 {
+			return
+		}
+		raw := p.Ints[jump]
+		jumpOp := newOpcode(raw)
+		jumpModes := raw / 1e2
+		if jumpOp != 5 && jumpOp != 6 || Mode(jumpModes%10) != d.modes[2] ||
+			jumpModes/10%10 >= int64(len(Modes)) || p.Ints[jump+1] != arg(2) {
+			return
+		}
+		d.op = superCompareJump
+		d.jumpOp = jumpOp
+		d.jumpMode = Mode(jumpModes / 10 % 10)
+	}
+}
+
+// collectFastStats adds the operations counted by the fast dispatch loop to the
+// stats and activates them again.
+func (p *Program) collectFastStats() {
+	p.Stats.Activated = true
+	for op, count := range p.opCounts {
+		if count > 0 {
+			p.Stats.Operations[opcode(op)] += count
+		}
+	}
+	for i, count := range p.superCounts {
+		if count > 0 {
+			p.Stats.Superinstructions[superinstructionNames[i]] += count
+		}
+	}
+	if len(p.Ints) > p.Stats.PeakMemory {
+		p.Stats.PeakMemory = len(p.Ints)
+	}
+	p.opCounts = [256]uint{}
+	p.superCounts = [len(superinstructionNames)]uint{}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	day5, err := ioutil.ReadFile("examples/program.ic")
+	assert.NoError(t, err)
+	for _, test := range transpileTests {
+		source := test.source
+		if test.name == "day5" {
+			source = string(day5)
+		}
+		for _, input := range test.inputs {
+			var optimizedOut, instrumentedOut bytes.Buffer
+			optimized := New(source, 42)
+			optimized.InputReader = strings.NewReader(input)
+			optimized.OutputWriter = &optimizedOut
+			optimized.Optimize = true
+			optimized.Exec()
+
+			instrumented := New(source, 42)
+			instrumented.InputReader = strings.NewReader(input)
+			instrumented.OutputWriter = &instrumentedOut
+			instrumented.execInstrumented()
+
+			assert.Equal(t, instrumentedOut.String(), optimizedOut.String(), test.name)
+			assert.Equal(t, instrumented.Ints, optimized.Ints, test.name)
+			assert.Equal(t, instrumented.Steps, optimized.Steps, test.name)
+		}
+	}
+}
+
+func TestOptimize_Superinstructions(t *testing.T) {
+	// Moves the value at 20 to 21 by adding 0, outputs it and jumps over the
+	// data at 9
+	var out bytes.Buffer
+	p := New("1001,20,0,21,4,21,1105,1,10,0,99,0,0,0,0,0,0,0,0,0,7,0", 0)
+	p.OutputWriter = &out
+	p.Optimize = true
+	p.Stats = NewStats()
+	p.Exec()
+	assert.Equal(t, "7\n", out.String())
+	assert.Equal(t, map[string]uint{"move": 1, "jump": 1}, p.Stats.Superinstructions)
+	assert.Equal(t, map[opcode]uint{1: 1, 4: 1, 5: 1, 99: 1}, p.Stats.Operations)
+	assert.True(t, p.Stats.Activated)
+
+	// The compare and the jump of the loop are fused
+	p = New(countLoop, 100)
+	p.Optimize = true
+	p.Stats = NewStats()
+	p.Exec()
+	assert.Equal(t, map[string]uint{"compare-jump": 100000}, p.Stats.Superinstructions)
+	assert.Equal(t, map[opcode]uint{1: 100000, 7: 100000, 5: 100000, 99: 1}, p.Stats.Operations)
+	assert.Equal(t, uint(300001), p.Stats.TotalOperations)
+}
+
+func TestOptimize_Invalidation(t *testing.T) {
+	// The compare at 0 writes 1 to the opcode of the jump at 4, which turns
+	// it into an add of 1 and 40, whose result 41 is output
+	var out bytes.Buffer
+	p := New("1107,1,2,4,1005,4,11,12,4,12,99,40,0", 0)
+	p.OutputWriter = &out
+	p.Optimize = true
+	p.Exec()
+	assert.Equal(t, "41\n", out.String())
+}
+
+func TestOptimize_Intervals(t *testing.T) {
+	// The hooks are due by the executed instructions, which are two for a
+	// compare-jump
+	dir := t.TempDir()
+	saved := map[bool]int{}
+	samples := map[bool]uint64{}
+	for _, optimize := range []bool{false, true} {
+		p := New("1001,100,1,100,1007,100,1000,101,1005,101,0,99", 100)
+		p.Optimize = optimize
+		p.Checkpoint = newCheckpointer(filepath.Join(dir, "state"), 7)
+		p.Progress = newProgressReporter(ioutil.Discard, 0)
+		p.Progress.sampleEvery = 5
+		p.Exec()
+		saved[optimize] = p.Checkpoint.Saved
+		for _, count := range p.Progress.samples {
+			samples[optimize] += count
+		}
+	}
+	assert.Equal(t, 3001/7, saved[false])
+	assert.Equal(t, saved[false], saved[true])
+	assert.Equal(t, samples[false], samples[true])
+}
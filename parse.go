@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ParseError is an invalid int of a program source.
+type ParseError struct {
+	Line   int
+	Column int
+	Token  string
+	// Err is strconv.ErrSyntax or strconv.ErrRange.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %q: %v", e.Line, e.Column, e.Token, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parser reads the ints of a program source in a single pass. Comments start
+// with a '#' and end at the end of the line. Ints are separated by commas and
+// whitespace, multiple separators are ignored.
+type parser struct {
+	r            *bufio.Reader
+	line, column int
+	token        []byte
+	// Lines are the line numbers of the ints, if recordLines is set.
+	Lines       []int
+	recordLines bool
+}
+
+// newParser creates a parser reading from r.
+func newParser(r io.Reader) *parser {
+	return &parser{r: bufio.NewReader(r), line: 1}
+}
+
+// parse reads all ints until the end of the source.
+func (ps *parser) parse() (ints, error) {
+	values := ints{}
+	tokenLine, tokenColumn := 0, 0
+	comment := false
+	for {
+		c, err := ps.r.ReadByte()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		end := err == io.EOF
+		ps.column++
+		separator := end || c == ',' || c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '#'
+		if !comment && !separator {
+			if len(ps.token) == 0 {
+				tokenLine, tokenColumn = ps.line, ps.column
+			}
+			ps.token = append(ps.token, c)
+		} else if len(ps.token) > 0 {
+			value, err := parseLiteral(ps.token)
+			if err != nil {
+				return nil, &ParseError{Line: tokenLine, Column: tokenColumn, Token: string(ps.token), Err: err}
+			}
+			values = append(values, value)
+			if ps.recordLines {
+				ps.Lines = append(ps.Lines, tokenLine)
+			}
+			ps.token = ps.token[:0]
+		}
+
+		switch {
+		case end:
+			return values, nil
+		case c == '#':
+			comment = true
+		case c == '\n':
+			comment = false
+			ps.line++
+			ps.column = 0
+		}
+	}
+}
+
+// parseLiteral parses a decimal, hexadecimal (0x) or binary (0b) int with an
+// optional sign. Underscores may separate digits.
+func parseLiteral(token []byte) (int64, error) {
+	negative := false
+	if len(token) > 0 && (token[0] == '+' || token[0] == '-') {
+		negative = token[0] == '-'
+		token = token[1:]
+	}
+	base := uint64(10)
+	if len(token) > 2 && token[0] == '0' {
+		switch token[1] {
+		case 'x', 'X':
+			base = 16
+			token = token[2:]
+		case 'b', 'B':
+			base = 2
+			token = token[2:]
+		}
+	}
+	if len(token) == 0 {
+		return 0, strconv.ErrSyntax
+	}
+
+	limit := uint64(1<<63 - 1)
+	if negative {
+		limit = 1 << 63
+	}
+	var n uint64
+	overflow := false
+	for i, c := range token {
+		if c == '_' {
+			if i == 0 || i == len(token)-1 || token[i-1] == '_' {
+				return 0, strconv.ErrSyntax
+			}
+			continue
+		}
+		digit := digitValue(c)
+		if digit >= base {
+			return 0, strconv.ErrSyntax
+		}
+		if n > (limit-digit)/base {
+			overflow = true
+		}
+		n = n*base + digit
+	}
+	if overflow {
+		return 0, strconv.ErrRange
+	}
+	if negative {
+		return int64(-n), nil
+	}
+	return int64(n), nil
+}
+
+// digitValue returns the value of the hexadecimal digit c, or 16 if c is no
+// digit.
+func digitValue(c byte) uint64 {
+	switch {
+	case '0' <= c && c <= '9':
+		return uint64(c - '0')
+	case 'a' <= c && c <= 'f':
+		return uint64(c - 'a' + 10)
+	case 'A' <= c && c <= 'F':
+		return uint64(c - 'A' + 10)
+	default:
+		return 16
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseLiteral(t *testing.T) {
+	for token, expected := range map[string]int64{
+		"0":                    0,
+		"010":                  10,
+		"+42":                  42,
+		"-42":                  -42,
+		"1_000_000":            1000000,
+		"0x1F":                 31,
+		"-0XfF":                -255,
+		"0b1010":               10,
+		"0B1111_0000":          240,
+		"9223372036854775807":  math.MaxInt64,
+		"-9223372036854775808": math.MinInt64,
+		"-0x8000000000000000":  math.MinInt64,
+	} {
+		value, err := parseLiteral([]byte(token))
+		assert.NoError(t, err, token)
+		assert.Equal(t, expected, value, token)
+	}
+
+	for token, expected := range map[string]error{
+		"":                    strconv.ErrSyntax,
+		"-":                   strconv.ErrSyntax,
+		"0x":                  strconv.ErrSyntax,
+		"12a":                 strconv.ErrSyntax,
+		"0b102":               strconv.ErrSyntax,
+		"_1":                  strconv.ErrSyntax,
+		"1_":                  strconv.ErrSyntax,
+		"1__0":                strconv.ErrSyntax,
+		"9223372036854775808": strconv.ErrRange,
+		"0x10000000000000000": strconv.ErrRange,
+	} {
+		_, err := parseLiteral([]byte(token))
+		assert.Equal(t, expected, err, token)
+	}
+}
+
+func TestNewFromReader(t *testing.T) {
+	p, err := NewFromReader(strings.NewReader("# Hex\n0x1,0b10 ,\n\n"), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, ints{1, 2, 0, 0}, p.Ints)
+	assert.Equal(t, 2, p.CodeLen)
+
+	p, err = NewFromReader(strings.NewReader(""), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, ints{0}, p.Ints)
+	assert.Equal(t, 0, p.CodeLen)
+
+	_, err = NewFromReader(strings.NewReader("1,2\n# 3x\n  4, 5x6,7"), 0)
+	var parseErr *ParseError
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, &ParseError{Line: 3, Column: 6, Token: "5x6", Err: strconv.ErrSyntax}, parseErr)
+	assert.Equal(t, `line 3, column 6: "5x6": invalid syntax`, err.Error())
+	assert.True(t, errors.Is(err, strconv.ErrSyntax))
+}
+
+func TestParser_Lines(t *testing.T) {
+	ps := newParser(strings.NewReader("1,2\n# Comment\n3 4\n5"))
+	ps.recordLines = true
+	_, err := ps.parse()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 1, 3, 3, 4}, ps.Lines)
+}
+
+// generatedProgram returns a program of n ints on lines of 10 with comments.
+func generatedProgram(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		if i%100 == 0 {
+			b.WriteString("# Block " + strconv.Itoa(i) + "\n")
+		}
+		b.WriteString(strconv.Itoa(i * 7919))
+		if i%10 == 9 {
+			b.WriteString(",\n")
+		} else {
+			b.WriteString(", ")
+		}
+	}
+	return b.String()
+}
+
+func BenchmarkNew(b *testing.B) {
+	source := generatedProgram(1000000)
+	b.SetBytes(int64(len(source)))
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(source, 0)
+	}
+}
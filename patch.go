@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MemoryPatch are values written to consecutive addresses starting at Address
+// before the execution.
+type MemoryPatch struct {
+	Address int
+	Values  ints
+}
+
+func (m MemoryPatch) String() string {
+	return strconv.Itoa(m.Address) + "=" + m.Values.String()
+}
+
+// ParseMemoryPatch parses a patch of the form <address>=<values>, where the
+// values are separated by commas. The values may be hexadecimal or binary like
+// the ints of a program.
+func ParseMemoryPatch(str string) (MemoryPatch, error) {
+	address, values, err := splitPatch(str)
+	if err != nil {
+		return MemoryPatch{}, err
+	}
+	m := MemoryPatch{Address: address}
+	for _, value := range strings.Split(values, ",") {
+		v, err := parseLiteral([]byte(strings.TrimSpace(value)))
+		if err != nil {
+			return MemoryPatch{}, fmt.Errorf("invalid patch %q: value %q: %w", str, value, err)
+		}
+		m.Values = append(m.Values, v)
+	}
+	return m, nil
+}
+
+// LoadMemoryPatch reads a patch of the ints in r, which are written starting
+// at address. The ints are parsed like a program.
+func LoadMemoryPatch(address int, r io.Reader) (MemoryPatch, error) {
+	values, err := newParser(r).parse()
+	if err != nil {
+		return MemoryPatch{}, err
+	}
+	return MemoryPatch{Address: address, Values: values}, nil
+}
+
+// splitPatch splits a patch of the form <address>=<value> into the address and
+// the value.
+func splitPatch(str string) (int, string, error) {
+	parts := strings.SplitN(str, "=", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("invalid patch %q: missing '='", str)
+	}
+	address, err := strconv.Atoi(parts[0])
+	if err != nil || address < 0 {
+		return 0, "", fmt.Errorf("invalid patch %q: invalid address", str)
+	}
+	return address, parts[1], nil
+}
+
+// Patch writes the patches to the memory in their order without counting them
+// as memory accesses of the program. All patches are checked to be within the
+// memory first, so that either all or none are applied. The patches are
+// reported in the debug output.
+func (p *Program) Patch(patches ...MemoryPatch) error {
+	for _, m := range patches {
+		if m.Address < 0 {
+			return fmt.Errorf("patch at negative address %d", m.Address)
+		}
+		// Compared without adding to the address, which may overflow
+		if m.Address > len(p.Ints)-len(m.Values) {
+			return fmt.Errorf("patch of %d ints at address %d exceeds the memory of %d ints",
+				len(m.Values), m.Address, len(p.Ints))
+		}
+	}
+	for _, m := range patches {
+		if p.Debug {
+			old := p.Ints[m.Address : m.Address+len(m.Values)]
+			fmt.Fprintf(p.DebugWriter, "Patch %d: %s (was %s)\n", m.Address, m.Values.String(), old.String())
+		}
+		for i, v := range m.Values {
+			p.store(m.Address+i, v)
+		}
+	}
+	return nil
+}
+
+// patchFlag is a repeatable flag of memory patches.
+type patchFlag struct {
+	patches *[]MemoryPatch
+	// load indicates whether the values are read from a file.
+	load bool
+}
+
+func (f patchFlag) String() string {
+	if f.patches == nil {
+		return ""
+	}
+	var patches []string
+	for _, m := range *f.patches {
+		patches = append(patches, m.String())
+	}
+	return strings.Join(patches, " ")
+}
+
+func (f patchFlag) Set(str string) error {
+	var m MemoryPatch
+	var err error
+	if f.load {
+		m, err = loadPatchFile(str)
+	} else {
+		m, err = ParseMemoryPatch(str)
+	}
+	if err != nil {
+		return err
+	}
+	*f.patches = append(*f.patches, m)
+	return nil
+}
+
+// loadPatchFile reads the patch of the form <address>=<file>.
+func loadPatchFile(str string) (MemoryPatch, error) {
+	address, filename, err := splitPatch(str)
+	if err != nil {
+		return MemoryPatch{}, err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return MemoryPatch{}, err
+	}
+	defer file.Close()
+	m, err := LoadMemoryPatch(address, file)
+	if err != nil {
+		return MemoryPatch{}, fmt.Errorf("%s: %w", filename, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseMemoryPatch(t *testing.T) {
+	m, err := ParseMemoryPatch("1=12")
+	assert.NoError(t, err)
+	assert.Equal(t, MemoryPatch{Address: 1, Values: ints{12}}, m)
+
+	m, err = ParseMemoryPatch("1000=1, -2,0x10")
+	assert.NoError(t, err)
+	assert.Equal(t, MemoryPatch{Address: 1000, Values: ints{1, -2, 16}}, m)
+	assert.Equal(t, "1000=1,-2,16", m.String())
+
+	for str, expected := range map[string]string{
+		"1":     `invalid patch "1": missing '='`,
+		"x=1":   `invalid patch "x=1": invalid address`,
+		"-1=1":  `invalid patch "-1=1": invalid address`,
+		"1=":    `invalid patch "1=": value "": invalid syntax`,
+		"1=2,,": `invalid patch "1=2,,": value "": invalid syntax`,
+	} {
+		_, err := ParseMemoryPatch(str)
+		assert.EqualError(t, err, expected, str)
+	}
+}
+
+func TestLoadMemoryPatch(t *testing.T) {
+	m, err := LoadMemoryPatch(5, strings.NewReader("# Table\n1, 2\n3\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, MemoryPatch{Address: 5, Values: ints{1, 2, 3}}, m)
+
+	_, err = LoadMemoryPatch(5, strings.NewReader("1,x"))
+	assert.EqualError(t, err, `line 1, column 3: "x": invalid syntax`)
+}
+
+func TestProgram_Patch(t *testing.T) {
+	p := New("1,0,0,0,99", 2)
+	debug := &strings.Builder{}
+	p.DebugWriter = debug
+	p.Debug = true
+	p.Stats = NewStats()
+	assert.NoError(t, p.Patch(MemoryPatch{Address: 1, Values: ints{5, 6}}, MemoryPatch{Address: 6, Values: ints{7}}))
+	assert.Equal(t, ints{1, 5, 6, 0, 99, 0, 7}, p.Ints)
+	assert.Equal(t, "Patch 1: 5,6 (was 0,0)\nPatch 6: 7 (was 0)\n", debug.String())
+	// Patches are no memory accesses of the program
+	assert.Empty(t, p.Stats.MemoryAccesses)
+
+	err := p.Patch(MemoryPatch{Address: 0, Values: ints{2}}, MemoryPatch{Address: 6, Values: ints{1, 2}})
+	assert.EqualError(t, err, "patch of 2 ints at address 6 exceeds the memory of 7 ints")
+	assert.Equal(t, int64(1), p.Ints[0])
+
+	maxInt := int(^uint(0) >> 1)
+	err = p.Patch(MemoryPatch{Address: maxInt, Values: ints{1, 2}})
+	assert.EqualError(t, err, fmt.Sprintf("patch of 2 ints at address %d exceeds the memory of 7 ints", maxInt))
+	err = p.Patch(MemoryPatch{Address: 0, Values: make(ints, 8)})
+	assert.EqualError(t, err, "patch of 8 ints at address 0 exceeds the memory of 7 ints")
+	err = p.Patch(MemoryPatch{Address: 2, Values: ints{3}}, MemoryPatch{Address: -1, Values: ints{1}})
+	assert.EqualError(t, err, "patch at negative address -1")
+	assert.Equal(t, int64(6), p.Ints[2])
+}
+
+func TestProgram_Patch_Snapshot(t *testing.T) {
+	p := New("99", 10)
+	s := p.Snapshot()
+	assert.NoError(t, p.Patch(MemoryPatch{Address: 3, Values: ints{4}}))
+	assert.Equal(t, int64(4), p.Snapshot().pages[0][3])
+	p.Restore(s)
+	assert.Equal(t, int64(0), p.Ints[3])
+}
+
+func TestPatchFlag(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "table")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("10,20"), 0664))
+
+	var patches []MemoryPatch
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Var(patchFlag{patches: &patches}, "set", "")
+	fs.Var(patchFlag{patches: &patches, load: true}, "load", "")
+	assert.NoError(t, fs.Parse([]string{"-set", "0=2", "-load", "100=" + filename, "-set", "1=3,4"}))
+	assert.Equal(t, []MemoryPatch{
+		{Address: 0, Values: ints{2}},
+		{Address: 100, Values: ints{10, 20}},
+		{Address: 1, Values: ints{3, 4}},
+	}, patches)
+
+	assert.Error(t, fs.Parse([]string{"-load", "0=" + filename + ".missing"}))
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// profiler counts the executions and memory accesses per instruction address.
+type profiler struct {
+	// Executions are the number of executions per instruction address.
+	Executions []uint64
+	// MemoryAccesses are the number of memory accesses per instruction address.
+	MemoryAccesses []uint64
+	// JumpTargets are the addresses that have been jumped to.
+	JumpTargets map[int]bool
+	// Symbols are the function names by their start address. If it is empty,
+	// the functions are inferred from the jump targets.
+	Symbols map[int]string
+	// StartTime is the time the profiling has started.
+	StartTime time.Time
+}
+
+func newProfiler() *profiler {
+	return &profiler{
+		JumpTargets: map[int]bool{},
+		Symbols:     map[int]string{},
+		StartTime:   time.Now(),
+	}
+}
+
+// grow increases the counters, so that address is a valid index.
+func (pr *profiler) grow(address int) {
+	if address < len(pr.Executions) {
+		return
+	}
+	size := 2*address + 1
+	executions := make([]uint64, size)
+	copy(executions, pr.Executions)
+	pr.Executions = executions
+	memoryAccesses := make([]uint64, size)
+	copy(memoryAccesses, pr.MemoryAccesses)
+	pr.MemoryAccesses = memoryAccesses
+}
+
+// execute counts the execution of the instruction at ip.
+func (pr *profiler) execute(ip int) {
+	pr.grow(ip)
+	pr.Executions[ip]++
+}
+
+// access counts a memory access by the instruction at ip.
+func (pr *profiler) access(ip int) {
+	pr.grow(ip)
+	pr.MemoryAccesses[ip]++
+}
+
+// jump records a jump to target.
+func (pr *profiler) jump(target int) {
+	pr.JumpTargets[target] = true
+}
+
+// readSymbols reads a symbol file into Symbols. Each line consists of an
+// address and a function name. Empty lines and lines starting with '#' are
+// ignored.
+func (pr *profiler) readSymbols(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("line %d: expected <address> <name>", lineNum)
+		}
+		address, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		pr.Symbols[address] = fields[1]
+	}
+	return scanner.Err()
+}
+
+// functions returns the sorted start addresses of the functions and their names.
+func (pr *profiler) functions() ([]int, map[int]string) {
+	names := map[int]string{}
+	if len(pr.Symbols) > 0 {
+		for address, name := range pr.Symbols {
+			names[address] = name
+		}
+	} else {
+		for address := range pr.JumpTargets {
+			names[address] = "fn_" + strconv.Itoa(address)
+		}
+		delete(names, 0)
+	}
+	if _, ok := names[0]; !ok {
+		names[0] = "main"
+	}
+
+	starts := make([]int, 0, len(names))
+	for address := range names {
+		starts = append(starts, address)
+	}
+	sort.Ints(starts)
+	return starts, names
+}
+
+// functionOf returns the start address of the function containing address.
+func functionOf(starts []int, address int) int {
+	i := sort.Search(len(starts), func(i int) bool { return starts[i] > address })
+	return starts[i-1]
+}
+
+// writePprof writes the profile in the gzip compressed pprof protobuf format to
+// w. listingFilename is the file name of the listing written by writeListing,
+// in which the line of an address is the address plus one.
+func (pr *profiler) writePprof(w io.Writer, listingFilename string) error {
+	strs := []string{""}
+	strIndex := map[string]int64{"": 0}
+	str := func(s string) int64 {
+		if i, ok := strIndex[s]; ok {
+			return i
+		}
+		strIndex[s] = int64(len(strs))
+		strs = append(strs, s)
+		return strIndex[s]
+	}
+
+	var profile protoBuffer
+	for _, sampleType := range []string{"executions", "memory_accesses"} {
+		var valueType protoBuffer
+		valueType.int64Field(1, str(sampleType))
+		valueType.int64Field(2, str("count"))
+		profile.messageField(1, &valueType)
+	}
+
+	starts, names := pr.functions()
+	for address := range pr.Executions {
+		if pr.Executions[address] == 0 && pr.MemoryAccesses[address] == 0 {
+			continue
+		}
+		var sample protoBuffer
+		sample.packedField(1, []uint64{uint64(address) + 1})
+		sample.packedField(2, []uint64{pr.Executions[address], pr.MemoryAccesses[address]})
+		profile.messageField(2, &sample)
+
+		var line protoBuffer
+		line.uint64Field(1, uint64(functionOf(starts, address))+1)
+		line.int64Field(2, int64(address)+1)
+		var location protoBuffer
+		location.uint64Field(1, uint64(address)+1)
+		location.uint64Field(3, uint64(address))
+		location.messageField(4, &line)
+		profile.messageField(4, &location)
+	}
+
+	for _, start := range starts {
+		var function protoBuffer
+		function.uint64Field(1, uint64(start)+1)
+		function.int64Field(2, str(names[start]))
+		function.int64Field(3, str(names[start]))
+		function.int64Field(4, str(listingFilename))
+		function.int64Field(5, int64(start)+1)
+		profile.messageField(5, &function)
+	}
+
+	// The string table has to be written after all strings have been added
+	for _, s := range strs {
+		profile.stringField(6, s)
+	}
+	profile.int64Field(9, pr.StartTime.UnixNano())
+	profile.int64Field(10, int64(time.Since(pr.StartTime)))
+	profile.int64Field(14, strIndex["executions"])
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.data); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeListing writes the memory to w, one address per line, so that line
+// address+1 shows the address. Executed instructions are disassembled.
+func (pr *profiler) writeListing(w io.Writer, memory ints) error {
+	buf := bufio.NewWriter(w)
+	for address := 0; address < len(memory); {
+		size := 1
+		text := strconv.FormatInt(memory[address], 10)
+		if address < len(pr.Executions) && pr.Executions[address] > 0 {
+			text, size = disassembleInstruction(memory, address)
+		}
+		fmt.Fprintf(buf, "%6d: %s\n", address, text)
+		for i := 1; i < size; i++ {
+			fmt.Fprintf(buf, "%6d:     %d\n", address+i, memory[address+i])
+		}
+		address += size
+	}
+	return buf.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestProtoBuffer(t *testing.T) {
+	var b protoBuffer
+	b.uint64Field(1, 300)
+	b.uint64Field(2, 0)
+	b.stringField(3, "")
+	b.packedField(4, []uint64{1, 2})
+	assert.Equal(t, []byte{0x08, 0xac, 0x02, 0x1a, 0x00, 0x22, 0x02, 0x01, 0x02}, b.data)
+}
+
+func TestProfiler(t *testing.T) {
+	p := New("1001,12,1,12,1007,12,3,13,1005,13,0,99", 2)
+	p.Profile = newProfiler()
+	p.Exec()
+	// The loop is executed three times
+	assert.Equal(t, uint64(3), p.Profile.Executions[0])
+	assert.Equal(t, uint64(1), p.Profile.Executions[11])
+	assert.Equal(t, uint64(9), p.Profile.MemoryAccesses[0])
+	assert.Equal(t, map[int]bool{0: true}, p.Profile.JumpTargets)
+
+	var out bytes.Buffer
+	assert.NoError(t, p.Profile.writePprof(&out, "program.lst"))
+	gz, err := gzip.NewReader(&out)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "memory_accesses")
+	assert.Contains(t, string(data), "program.lst")
+}
+
+func TestProfiler_Functions(t *testing.T) {
+	pr := newProfiler()
+	pr.jump(10)
+	pr.jump(4)
+	starts, names := pr.functions()
+	assert.Equal(t, []int{0, 4, 10}, starts)
+	assert.Equal(t, "fn_4", names[4])
+	assert.Equal(t, 4, functionOf(starts, 9))
+	assert.Equal(t, 10, functionOf(starts, 10))
+
+	assert.NoError(t, pr.readSymbols(strings.NewReader("# Symbols\n5 loop\n\n")))
+	starts, names = pr.functions()
+	assert.Equal(t, []int{0, 5}, starts)
+	assert.Equal(t, "loop", names[5])
+	assert.Equal(t, "main", names[0])
+}
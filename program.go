@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"regexp"
-	"strconv"
 	"strings"
 )
 
@@ -15,6 +13,9 @@ type Program struct {
 	// Ints is the actual program, i.e. an array of the instructions with the
 	// corresponding arguments.
 	Ints ints
+	// CodeLen is the number of ints of the parsed program, i.e. the length of
+	// Ints without the additional memory.
+	CodeLen int
 	// IP is the instruction pointer. It is the index in the Ints array of the
 	// instruction that is currently being executed.
 	IP int
@@ -24,22 +25,118 @@ type Program struct {
 	RelBase int64
 	// InputReader is the io.Reader, from which the input for the program is read.
 	InputReader io.Reader
+	// InputSource provides the input values instead of InputReader, e.g. an
+	// adapter reading characters. It is not used if it is nil.
+	InputSource InputSource
+	// EOF defines the reaction to reading beyond the end of the input, which
+	// crashes the program by default.
+	EOF EOFPolicy
 	// DebugWriter is the io.Writer where input prompts are written to.
 	DebugWriter io.Writer
 	// OutputWriter is the io.Writer, in which output of the program is written.
+	// If it has a Flush method like bufio.Writer, it is flushed when the
+	// execution stops and before reading input.
 	OutputWriter io.Writer
+	// OutputSink receives the output values instead of OutputWriter, e.g. an
+	// adapter writing characters. It is not used if it is nil. An output sink
+	// writing to OutputWriter is flushed with it.
+	OutputSink OutputSink
 	// Finish indicates whether the program has finished running.
 	Finish bool
 	// Stats contains detailed information about the program execution.
-	Stats stats
+	Stats Stats
 	// Debug indicates whether showDebug outputs should be shown.
 	Debug bool
+	// Steps is the number of instructions that have been executed so far.
+	Steps int
+	// Inputs is the number of input values that have been read so far.
+	Inputs int
+	// Outputs is the number of values that have been output so far.
+	Outputs int
+	// TraceWriter is the io.Writer, in which a trace of every executed
+	// instruction is written. No trace is written if it is nil.
+	TraceWriter io.Writer
+	// SelfMod detects writes to executed addresses and executions of written
+	// addresses. Self-modifications are not tracked if it is nil.
+	SelfMod *selfModTracker
+	// CallStack reconstructs the function calls of the program. The calls are
+	// not tracked if it is nil.
+	CallStack *callStack
+	// Crash records the last executed instructions and the outputs for a core
+	// dump. Nothing is recorded if it is nil.
+	Crash *crashRecorder
+	// Profile counts the executions and memory accesses per instruction
+	// address. Nothing is counted if it is nil.
+	Profile *profiler
+	// Cover records the executed instructions and the outcomes of conditional
+	// jumps. Nothing is recorded if it is nil.
+	Cover *coverage
+	// Progress periodically reports the progress of the execution. Nothing is
+	// reported if it is nil.
+	Progress *progressReporter
+	// Checkpoint periodically saves the state of the program to a file, from
+	// which the execution can be resumed. Nothing is saved if it is nil.
+	Checkpoint *checkpointer
+	// Loop detects infinite loops without input and output. Loops are not
+	// detected if it is nil.
+	Loop *loopDetector
+	// Optimize indicates whether the fast dispatch loop turns idioms and
+	// sequences of instructions into superinstructions.
+	Optimize bool
+	// decoded is the cache of decoded instructions of the fast dispatch loop.
+	decoded []decodedInstruction
+	// argBuf holds the argument indexes passed to instructions by the fast
+	// dispatch loop, to avoid allocating them.
+	argBuf [maxInstructionSize - 1]int
+	// opCounts are the executed operations by opcode, which are counted by the
+	// fast dispatch loop for the stats.
+	opCounts [256]uint
+	// superCounts are the executed superinstructions.
+	superCounts [len(superinstructionNames)]uint
+	// outputLine is the buffer, in which Output formats a value.
+	outputLine [24]byte
+	// base is the last snapshot taken or restored, whose pages are shared with
+	// the memory except for the dirty pages.
+	base *Snapshot
+	// dirty marks the pages of the memory written since base.
+	dirty []bool
 }
 
-// Exec executes a program.
+// Exec executes a program starting at Program.IP. If no instrumenting feature
+// is activated, the fast dispatch loop is used.
 func (p *Program) Exec() {
-	p.Stats.start()
-	for p.IP = 0; p.IP < len(p.Ints); {
+	// Flush on halt and on errors
+	defer p.flushOutput()
+	p.Stats.start(p.CodeLen, len(p.Ints))
+	if p.instrumented() {
+		p.execInstrumented()
+	} else {
+		p.execFast()
+	}
+	p.Stats.stop()
+	if p.TraceWriter != nil {
+		p.traceMemory()
+	}
+}
+
+// flushOutput flushes the OutputWriter, if it is buffered. Write errors are
+// ignored like for the output values.
+func (p *Program) flushOutput() {
+	if flusher, ok := p.OutputWriter.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+}
+
+// execInstrumented executes the program by decoding every instruction before
+// its execution.
+func (p *Program) execInstrumented() {
+	for p.IP < len(p.Ints) {
+		if p.Checkpoint != nil {
+			p.Checkpoint.execute(p)
+		}
+		if p.Loop != nil {
+			p.Loop.execute(p)
+		}
 		p.MoveIP = true
 		// Parse current instruction
 		op := newOpcode(p.Ints[p.IP])
@@ -51,7 +148,6 @@ func (p *Program) Exec() {
 			break
 		}
 	}
-	p.Stats.stop()
 }
 
 // execInstruction executes an instruction.
@@ -61,9 +157,42 @@ func (p *Program) execInstruction(op opcode, argIndexes []int) {
 	if opInfo.Fn == nil {
 		fmt.Fprintln(p.DebugWriter, "Unknown opcode", op.String())
 	}
+	if p.TraceWriter != nil {
+		p.traceInstruction(op)
+	}
+	if p.SelfMod != nil {
+		p.SelfMod.execute(p, len(argIndexes))
+	}
+	if p.Crash != nil {
+		p.Crash.execute(p, op)
+	}
+	if p.Profile != nil {
+		p.Profile.execute(p.IP)
+	}
+	if p.Progress != nil {
+		p.Progress.execute(p)
+	}
+	ip, raw := p.IP, p.Ints[p.IP]
+	if p.Stats.Activated {
+		p.Stats.op = op
+	}
 	opInfo.Fn(p, argIndexes)
+	if p.Profile != nil && !p.MoveIP {
+		p.Profile.jump(p.IP)
+	}
+	if p.Cover != nil {
+		p.Cover.execute(ip)
+		if op == 5 || op == 6 {
+			p.Cover.branch(ip, !p.MoveIP)
+		}
+	}
+	callStackChanged := p.CallStack != nil && p.CallStack.execute(p, ip, raw, op)
+	p.Steps++
 	if p.Debug {
 		p.debugInstruction(op, argIndexes)
+		if callStackChanged {
+			fmt.Fprint(p.DebugWriter, "Call stack:\n"+p.CallStack.backtrace(p.IP))
+		}
 	}
 	if p.Stats.Activated {
 		// Increment operations count
@@ -88,7 +217,13 @@ func (p *Program) debugInstruction(op opcode, argIndexes []int) {
 
 	// Print raw integers
 	raw := p.Ints[p.IP : p.IP+opcodes[op].ArgNum+1]
-	fmt.Fprintln(p.DebugWriter, " (Raw: "+raw.String()+")")
+	fmt.Fprint(p.DebugWriter, " (Raw: "+raw.String()+")")
+
+	// Print current function
+	if p.CallStack != nil && len(p.CallStack.Frames) > 0 {
+		fmt.Fprintf(p.DebugWriter, " in function %d", p.CallStack.function())
+	}
+	fmt.Fprintln(p.DebugWriter)
 }
 
 // newArgIndexList returns a list of indexes of the arguments starting by
@@ -102,66 +237,58 @@ func (p *Program) newArgIndexList(startIndex int, modes []Mode) []int {
 	}
 
 	argIndexes := make([]int, argNum)
+	p.Stats.argNum = 0
 	for i := 0; i < argNum; i++ {
 		if int(modes[i]) > len(Modes) {
 			panic(fmt.Sprintf("Unkown mode %s", modes[i]))
 		}
 		info := Modes[modes[i]]
 		argIndexes[i] = info.Fn(p, startIndex+i)
+		if p.Stats.Activated {
+			p.Stats.argument(i, argIndexes[i], modes[i])
+		}
 	}
 	return argIndexes
 }
 
 // New parses a new program of the provided string. For running the program
 // additionalMemory many int64s are allocated in addition to the program memory.
-// Comment lines starting with an '#' will be ignored, spaces will be converted
-// into commas and multiple commas and newlines will be ignored.
+// Comments start with a '#' and end at the end of the line, ints are separated
+// by commas and whitespace, and multiple separators are ignored. Invalid ints
+// result in a panic with a ParseError.
 func New(intsStr string, additionalMemory uint) *Program {
-	intsStr = clean(intsStr)
-	intsStrArr := strings.Split(intsStr, ",")
-
-	// Parse each value to a number
-	intsArr := make(ints, len(intsStrArr)+int(additionalMemory))
-	for i, v := range intsStrArr {
-		var err error
-		intsArr[i], err = strconv.ParseInt(v, 10, 64)
-		if err != nil {
-			panic(err)
-		}
+	p, err := NewFromReader(strings.NewReader(intsStr), additionalMemory)
+	if err != nil {
+		panic(err)
 	}
+	return p
+}
+
+// NewFromReader parses a new program from r like New in a single pass. Besides
+// decimal ints, it accepts hexadecimal (0x) and binary (0b) ints, whose digits
+// may be separated by underscores.
+func NewFromReader(r io.Reader, additionalMemory uint) (*Program, error) {
+	intsArr, err := newParser(r).parse()
+	if err != nil {
+		return nil, err
+	}
+	codeLen := len(intsArr)
 	return &Program{
-		Ints:         intsArr,
+		Ints:         append(intsArr, make(ints, additionalMemory)...),
+		CodeLen:      codeLen,
 		InputReader:  os.Stdin,
 		DebugWriter:  os.Stderr,
 		OutputWriter: os.Stdout,
-	}
-}
-
-// clean removes comment lines starting with a '#', converts spaces into commas,
-// and removes multiple commas and newlines.
-func clean(str string) string {
-	// Remove comment lines starting with #
-	commentRegex := regexp.MustCompile("(?m)\\s*#.*$")
-	str = commentRegex.ReplaceAllString(str, "")
-
-	// Convert spaces and newlines into commas
-	str = strings.ReplaceAll(str, "\n", ",")
-	str = strings.ReplaceAll(str, " ", ",")
-
-	// Remove possible first empty value (due to a comment at the beginning of the program)
-	beginProgramRegex := regexp.MustCompile("^,")
-	str = beginProgramRegex.ReplaceAllString(str, "")
-
-	// Remove multiple commas
-	multipleCommas := regexp.MustCompile("[,]+")
-	str = multipleCommas.ReplaceAllString(str, ",")
-	return str
+	}, nil
 }
 
 func (p *Program) Get(index int) int64 {
 	p.increaseMemoryIfNecessary(index)
 	if p.Stats.Activated {
-		p.Stats.MemoryAccesses["Get"]++
+		p.Stats.access("Get", index)
+	}
+	if p.Profile != nil {
+		p.Profile.access(p.IP)
 	}
 	return p.Ints[index]
 }
@@ -169,7 +296,23 @@ func (p *Program) Get(index int) int64 {
 func (p *Program) Set(index int, value int64) {
 	p.increaseMemoryIfNecessary(index)
 	if p.Stats.Activated {
-		p.Stats.MemoryAccesses["Set"]++
+		p.Stats.access("Set", index)
+	}
+	if p.SelfMod != nil {
+		p.SelfMod.write(p, index)
+	}
+	if p.CallStack != nil {
+		p.CallStack.write(p, value)
+	}
+	if p.Profile != nil {
+		p.Profile.access(p.IP)
+	}
+	if p.decoded != nil {
+		p.invalidate(index)
+	}
+	p.markDirty(index)
+	if p.Loop != nil {
+		p.Loop.write(index)
 	}
 	p.Ints[index] = value
 }
@@ -177,11 +320,11 @@ func (p *Program) Set(index int, value int64) {
 func (p *Program) increaseMemoryIfNecessary(index int) {
 	if index >= len(p.Ints) {
 		// Memory address is out of range -> allocate more memory
-		p.increaseMemory(index + 1 - len(p.Ints))
+		p.increaseMemory(index + 1)
 	}
 }
 
-// increaseMemory increases the memory of Program.Ints by delta.
+// increaseMemory increases the memory of Program.Ints to newSize.
 func (p *Program) increaseMemory(newSize int) {
 	difference := newSize - len(p.Ints)
 	if difference <= 0 {
@@ -197,4 +340,7 @@ func (p *Program) increaseMemory(newSize int) {
 	intsLarge := make(ints, newSize)
 	copy(intsLarge, p.Ints)
 	p.Ints = intsLarge
+	if p.Stats.Activated {
+		p.Stats.grow(newSize)
+	}
 }
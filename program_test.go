@@ -5,13 +5,19 @@ import (
 	"testing"
 )
 
-func TestProgram_clean(t *testing.T) {
-	assert.Equal(t, "1,2,3,5", clean("1,2,3,5"))
-	assert.Equal(t, "1,2,3,5", clean("\n1,2\n,\n3,5"))
-	assert.Equal(t, "1,2,3,5", clean("1 2 3 5"))
-	assert.Equal(t, "1,2,3,5", clean("1,2,3,\n# Hallo\n,5"))
-	assert.Equal(t, "1,2,3,5", clean("1 \n,\n,\n 2 \n 3,, 5"))
-	assert.Equal(t, "1,2,3,5", clean("1 \n,\n,#Hallo\n 2 \n 3,, 5"))
+func TestNew_Separators(t *testing.T) {
+	for _, source := range []string{
+		"1,2,3,5",
+		"\n1,2\n,\n3,5",
+		"1 2 3 5",
+		"1,2,3,\n# Hallo\n,5",
+		"1 \n,\n,\n 2 \n 3,, 5",
+		"1 \n,\n,#Hallo\n 2 \n 3,, 5",
+		"# Comment\n1,2,3,5\n",
+		"1\t2\r\n3#Comment\n5",
+	} {
+		assert.Equal(t, ints{1, 2, 3, 5}, New(source, 0).Ints, source)
+	}
 }
 
 func TestNewProgram(t *testing.T) {
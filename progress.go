@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// progressSampleEvery is the number of executed instructions between two
+// samples of the IP. It is a prime number to avoid sampling the same
+// instructions of loops over and over.
+const progressSampleEvery = 1009
+
+// progressTopIPs is the number of most sampled IPs shown in a report.
+const progressTopIPs = 5
+
+// progressReporter periodically writes a report of the progress of a long
+// running program. The IP is sampled every sampleEvery instructions, and at
+// these samples it is checked whether a report is due.
+type progressReporter struct {
+	Writer io.Writer
+	// Interval is the duration between two reports. No reports are written
+	// periodically if it is zero, but they can still be requested.
+	Interval    time.Duration
+	sampleEvery int
+	interval    stepInterval
+	// samples are the sampled IPs since the last report.
+	samples    map[int]uint64
+	startTime  time.Time
+	lastReport time.Time
+	lastSteps  int
+	// requested is set to 1 by request, e.g. from a signal handler.
+	requested int32
+}
+
+// newProgressReporter creates a progress reporter writing to w every interval.
+func newProgressReporter(w io.Writer, interval time.Duration) *progressReporter {
+	now := time.Now()
+	return &progressReporter{
+		Writer:      w,
+		Interval:    interval,
+		sampleEvery: progressSampleEvery,
+		samples:     map[int]uint64{},
+		startTime:   now,
+		lastReport:  now,
+	}
+}
+
+// request a report at the next sample. It is safe to call from another
+// goroutine.
+func (r *progressReporter) request() {
+	atomic.StoreInt32(&r.requested, 1)
+}
+
+// execute counts the execution of the instruction at p.IP, samples it and
+// reports the progress if a report is due.
+func (r *progressReporter) execute(p *Program) {
+	if !r.interval.due(p.Steps, r.sampleEvery) {
+		return
+	}
+	r.samples[p.IP]++
+
+	requested := atomic.CompareAndSwapInt32(&r.requested, 1, 0)
+	if requested || (r.Interval > 0 && time.Since(r.lastReport) >= r.Interval) {
+		r.report(p)
+	}
+}
+
+// report writes the number of executed instructions, the IP, the operations
+// per second and the memory size of p, as well as the most sampled IPs since
+// the last report.
+func (r *progressReporter) report(p *Program) {
+	now := time.Now()
+	opsPerSecond := 0.0
+	if seconds := now.Sub(r.lastReport).Seconds(); seconds > 0 {
+		opsPerSecond = float64(p.Steps-r.lastSteps) / seconds
+	}
+	fmt.Fprintf(r.Writer, "progress %s: %d instructions, IP %d, %.0f ops/sec, memory %d ints, top IPs %s\n",
+		now.Sub(r.startTime).Round(time.Millisecond), p.Steps, p.IP, opsPerSecond, len(p.Ints), r.topIPs())
+
+	r.lastReport = now
+	r.lastSteps = p.Steps
+	r.samples = map[int]uint64{}
+}
+
+// topIPs formats the most sampled IPs with their share of the samples.
+func (r *progressReporter) topIPs() string {
+	ips := sortedKeys(r.samples)
+	total := uint64(0)
+	for _, count := range r.samples {
+		total += count
+	}
+	if total == 0 {
+		return "none"
+	}
+	sort.SliceStable(ips, func(i, j int) bool {
+		return r.samples[ips[i]] > r.samples[ips[j]]
+	})
+	if len(ips) > progressTopIPs {
+		ips = ips[:progressTopIPs]
+	}
+	parts := make([]string, len(ips))
+	for i, ip := range ips {
+		parts[i] = fmt.Sprintf("%d (%.1f%%)", ip, float64(r.samples[ip])/float64(total)*100)
+	}
+	return strings.Join(parts, ", ")
+}
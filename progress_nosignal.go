@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+// progressSignalSupported indicates whether a progress report can be requested
+// by a signal.
+const progressSignalSupported = false
+
+// notifyProgress does nothing, because there is no SIGUSR1 on this platform.
+func notifyProgress(r *progressReporter) {}
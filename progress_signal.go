@@ -0,0 +1,26 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// progressSignalSupported indicates whether a progress report can be requested
+// by a signal.
+const progressSignalSupported = true
+
+// notifyProgress requests a progress report of r whenever the process receives
+// SIGUSR1.
+func notifyProgress(r *progressReporter) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			r.request()
+		}
+	}()
+}
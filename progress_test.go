@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestProgressReporter(t *testing.T) {
+	// Endless loop: add 1 to the counter at 100 and jump back to 0
+	p := New("1001,100,1,100,1105,1,0", 94)
+	var out bytes.Buffer
+	p.Progress = newProgressReporter(&out, time.Hour)
+	p.Progress.sampleEvery = 10
+
+	execSteps(p, 100)
+	assert.Empty(t, out.String())
+	// Every 10th instruction is the jump at 4
+	assert.Equal(t, map[int]uint64{4: 10}, p.Progress.samples)
+
+	p.Progress.request()
+	execSteps(p, 10)
+	assert.Regexp(t, regexp.MustCompile(`^progress \S+: 109 instructions, IP 4, \d+ ops/sec, memory 101 ints, top IPs 4 \(100\.0%\)\n$`), out.String())
+	assert.Empty(t, p.Progress.samples)
+}
+
+func TestProgressReporter_TopIPs(t *testing.T) {
+	r := newProgressReporter(nil, 0)
+	assert.Equal(t, "none", r.topIPs())
+	r.samples = map[int]uint64{1: 1, 2: 6, 3: 2, 4: 1, 5: 0, 6: 0}
+	assert.Equal(t, "2 (60.0%), 3 (20.0%), 1 (10.0%), 4 (10.0%), 5 (0.0%)", r.topIPs())
+}
+
+// execSteps executes n instructions of p.
+func execSteps(p *Program, n int) {
+	for i := 0; i < n; i++ {
+		p.MoveIP = true
+		op := newOpcode(p.Ints[p.IP])
+		p.execInstruction(op, p.newArgIndexList(p.IP+1, NewModeList(p.Ints[p.IP], opcodes[op].ArgNum)))
+	}
+}
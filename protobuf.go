@@ -0,0 +1,65 @@
+package main
+
+// Wire types of the protocol buffer encoding.
+const (
+	wireVarint          = 0
+	wireLengthDelimited = 2
+)
+
+// protoBuffer is a minimal protocol buffer encoder, which only supports the
+// field types needed to write pprof profiles.
+type protoBuffer struct {
+	data []byte
+}
+
+// varint appends x in the varint encoding.
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+// key appends the key of a field with the wire type.
+func (b *protoBuffer) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// uint64Field appends an uint64 field. Zero values are omitted.
+func (b *protoBuffer) uint64Field(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(x)
+}
+
+// int64Field appends an int64 field. Zero values are omitted.
+func (b *protoBuffer) int64Field(field int, x int64) {
+	b.uint64Field(field, uint64(x))
+}
+
+// stringField appends a string field. In contrast to the numeric fields, empty
+// strings are not omitted, as they are used in repeated fields.
+func (b *protoBuffer) stringField(field int, s string) {
+	b.key(field, wireLengthDelimited)
+	b.varint(uint64(len(s)))
+	b.data = append(b.data, s...)
+}
+
+// messageField appends an embedded message field.
+func (b *protoBuffer) messageField(field int, message *protoBuffer) {
+	b.key(field, wireLengthDelimited)
+	b.varint(uint64(len(message.data)))
+	b.data = append(b.data, message.data...)
+}
+
+// packedField appends a repeated numeric field in the packed encoding.
+func (b *protoBuffer) packedField(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.messageField(field, &packed)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxSearchCombinations is the maximum number of combinations of a search,
+// which is also the maximum number of values of a patch range.
+const maxSearchCombinations = 1 << 24
+
+// patchRange are the values, which are searched for the int at Address.
+type patchRange struct {
+	Address int
+	Values  ints
+}
+
+// parsePatchRange parses a patch range of the form <address>=<values>, where
+// values are comma separated values or inclusive ranges like 0..99.
+func parsePatchRange(str string) (patchRange, error) {
+	parts := strings.SplitN(str, "=", 2)
+	if len(parts) != 2 {
+		return patchRange{}, fmt.Errorf("invalid patch range %q: missing '='", str)
+	}
+	address, err := strconv.Atoi(parts[0])
+	if err != nil || address < 0 {
+		return patchRange{}, fmt.Errorf("invalid patch range %q: invalid address", str)
+	}
+	values, err := parseValueRanges(parts[1], maxSearchCombinations)
+	if err != nil {
+		return patchRange{}, fmt.Errorf("invalid patch range %q: %v", str, err)
+	}
+	return patchRange{Address: address, Values: values}, nil
+}
+
+// parseValueRanges parses comma separated values or inclusive ranges like
+// 0..99 into the list of their values. More than max values are rejected before
+// the list is built.
+func parseValueRanges(str string, max int) (ints, error) {
+	var list ints
+	for _, values := range strings.Split(str, ",") {
+		bounds := strings.SplitN(values, "..", 2)
+		low, err := parseLiteral([]byte(bounds[0]))
+		high := low
+		if err == nil && len(bounds) == 2 {
+			high, err = parseLiteral([]byte(bounds[1]))
+		}
+		if err != nil || high < low {
+			return nil, fmt.Errorf("invalid values %q", values)
+		}
+		// The difference may exceed the range of int64
+		if uint64(high)-uint64(low) >= uint64(max-len(list)) {
+			return nil, errors.New("too many values")
+		}
+		for v := low; ; v++ {
+			list = append(list, v)
+			if v == high {
+				break
+			}
+		}
+	}
+	return list, nil
+}
+
+// searchCondition compares an int of the final memory or the output with a
+// value.
+type searchCondition struct {
+	// Output indicates whether Index is an index of the output values instead
+	// of an address. Negative indexes count from the last output value.
+	Output   bool
+	Index    int
+	Operator string
+	Value    int64
+}
+
+var searchConditionRegexp = regexp.MustCompile(`^\s*(mem|out)\[(-?\d+)\]\s*(==|!=|<=|>=|<|>)\s*(\S+)\s*$`)
+
+// parseSearchConditions parses conditions like "mem[0]==19690720" or
+// "out[-1]>100", which are joined by "&&".
+func parseSearchConditions(str string) ([]searchCondition, error) {
+	var conditions []searchCondition
+	for _, part := range strings.Split(str, "&&") {
+		m := searchConditionRegexp.FindStringSubmatch(part)
+		if m == nil {
+			return nil, fmt.Errorf("invalid condition %q", strings.TrimSpace(part))
+		}
+		index, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition %q: %w", strings.TrimSpace(part), err)
+		}
+		value, err := parseLiteral([]byte(m[4]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition %q: %w", strings.TrimSpace(part), err)
+		}
+		if m[1] == "mem" && index < 0 {
+			return nil, fmt.Errorf("invalid condition %q: negative address", strings.TrimSpace(part))
+		}
+		conditions = append(conditions, searchCondition{Output: m[1] == "out", Index: index, Operator: m[3], Value: value})
+	}
+	return conditions, nil
+}
+
+// matches reports whether the condition holds for the memory and the output.
+// Memory and output values, which do not exist, do not match.
+func (c searchCondition) matches(memory ints, output ints) bool {
+	values, index := memory, c.Index
+	if c.Output {
+		values = output
+		if index < 0 {
+			index += len(output)
+		}
+	}
+	if index < 0 || index >= len(values) {
+		return false
+	}
+	v := values[index]
+	switch c.Operator {
+	case "==":
+		return v == c.Value
+	case "!=":
+		return v != c.Value
+	case "<":
+		return v < c.Value
+	case "<=":
+		return v <= c.Value
+	case ">":
+		return v > c.Value
+	default:
+		return v >= c.Value
+	}
+}
+
+// searchMatch is a combination of patch values, for which the conditions hold.
+type searchMatch struct {
+	// Index is the index of the combination in the order of the search.
+	Index  int
+	Values ints
+	Output ints
+}
+
+// searchResult summarizes a search.
+type searchResult struct {
+	Matches []searchMatch
+	// Runs is the number of executed combinations, and Failed the number of
+	// crashed runs.
+	Runs, Failed int
+	// Stopped indicates whether the search has stopped early.
+	Stopped bool
+}
+
+// countCombinations returns the number of combinations of the values of the
+// patch ranges, which must not exceed maxSearchCombinations.
+func countCombinations(ranges []patchRange) (int, error) {
+	total := 1
+	for _, r := range ranges {
+		// Checked before multiplying, which may overflow
+		if len(r.Values) > 0 && total > maxSearchCombinations/len(r.Values) {
+			return 0, fmt.Errorf("more than %d combinations", maxSearchCombinations)
+		}
+		total *= len(r.Values)
+	}
+	return total, nil
+}
+
+// search runs the program of base with every combination of the values of the
+// patch ranges on workers many goroutines. The first range changes slowest.
+// Each run reads the input from the beginning. Crashed runs do not match. If
+// maxMatches is positive, no further combinations are run after finding as
+// many matches, and the first maxMatches matches in the order of the search
+// are returned. More than maxSearchCombinations combinations panic.
+func search(base *Snapshot, ranges []patchRange, input []byte, conditions []searchCondition,
+	workers int, maxMatches int, setup func(p *Program)) *searchResult {
+	total, err := countCombinations(ranges)
+	if err != nil {
+		panic(err)
+	}
+
+	var (
+		mutex   sync.Mutex
+		result  = &searchResult{}
+		found   int32
+		next    int64 = -1
+		wg      sync.WaitGroup
+		stopped = func() bool {
+			return maxMatches > 0 && int(atomic.LoadInt32(&found)) >= maxMatches
+		}
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values := make(ints, len(ranges))
+			for !stopped() {
+				// Combinations are started in order, so that all combinations
+				// before a match are run when stopping early
+				index := int(atomic.AddInt64(&next, 1))
+				if index >= total {
+					return
+				}
+				rest := index
+				for j := len(ranges) - 1; j >= 0; j-- {
+					values[j] = ranges[j].Values[rest%len(ranges[j].Values)]
+					rest /= len(ranges[j].Values)
+				}
+
+				p := &Program{DebugWriter: ioutil.Discard}
+				p.Restore(base)
+				p.InputReader = bytes.NewReader(input)
+				var output bytes.Buffer
+				p.OutputWriter = &output
+				for j, r := range ranges {
+					p.Set(r.Address, values[j])
+				}
+				setup(p)
+				err := p.execRecover()
+				outputs, _ := newParser(&output).parse()
+				match := err == nil
+				for _, c := range conditions {
+					match = match && c.matches(p.Ints, outputs)
+				}
+
+				mutex.Lock()
+				result.Runs++
+				if err != nil {
+					result.Failed++
+				}
+				if match {
+					atomic.AddInt32(&found, 1)
+					result.Matches = append(result.Matches, searchMatch{
+						Index: index, Values: append(ints{}, values...), Output: outputs,
+					})
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(result.Matches, func(i, j int) bool {
+		return result.Matches[i].Index < result.Matches[j].Index
+	})
+	if stopped() {
+		result.Matches = result.Matches[:maxMatches]
+		result.Stopped = result.Runs < total
+	}
+	return result
+}
+
+// searchCommand searches for the values of memory patches, for which the
+// final memory or the output of a program matches a condition.
+func searchCommand(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s search <flags> <program> <address>=<values>...\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Values are comma separated values or inclusive ranges, e.g. 1=0..99 2=0..99 or 5=1,3,10..20.")
+		fmt.Fprintln(fs.Output(), "The first range changes slowest.\n\nFlags:")
+		fs.PrintDefaults()
+	}
+	target := fs.String("target", "", "Condition on the final memory or the output, e.g. 'mem[0]==19690720' or "+
+		"'out[-1]>100' for the last output value. Conditions can be joined by '&&'")
+	maxMatches := fs.Int("max", 0, "Stop after finding this many matches, or 0 to search all combinations")
+	workers := fs.Int("workers", runtime.GOMAXPROCS(0), "Number of programs run in parallel")
+	inputFilename := fs.String("input", "", "File to read the input values of every run from")
+	memory := fs.Uint("mem", 42, "Number of ints that are allocated for the memory in addition to the program")
+	optimize := fs.Bool("optimize", false, "Fuse idioms and sequences of instructions into superinstructions")
+	loopInterval := fs.Int("detect-loops", 0, "Number of executed instructions between two checks for infinite loops, "+
+		"which fail the run")
+	showOutput := fs.Bool("show-output", false, "Show the output values of the matches")
+	fs.Parse(args)
+	if fs.NArg() < 2 || *target == "" || *workers < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	conditions, err := parseSearchConditions(*target)
+	if err != nil {
+		panic(err)
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	p, err := NewFromReader(file, *memory)
+	file.Close()
+	if err != nil {
+		panic(fmt.Sprintf("%s: %v", fs.Arg(0), err))
+	}
+	var ranges []patchRange
+	for _, arg := range fs.Args()[1:] {
+		r, err := parsePatchRange(arg)
+		if err != nil {
+			panic(err)
+		}
+		if r.Address >= len(p.Ints) {
+			panic(fmt.Errorf("invalid patch range %q: address outside of the memory of %d ints", arg, len(p.Ints)))
+		}
+		ranges = append(ranges, r)
+	}
+	combinations, err := countCombinations(ranges)
+	if err != nil {
+		panic(err)
+	}
+	var input []byte
+	if *inputFilename != "" {
+		if input, err = ioutil.ReadFile(*inputFilename); err != nil {
+			panic(err)
+		}
+	}
+
+	start := time.Now()
+	result := search(p.Snapshot(), ranges, input, conditions, *workers, *maxMatches, func(p *Program) {
+		p.Optimize = *optimize
+		if *loopInterval > 0 {
+			p.Loop = newLoopDetector(*loopInterval)
+		}
+	})
+	for _, m := range result.Matches {
+		patches := make([]string, len(ranges))
+		for i, r := range ranges {
+			patches[i] = fmt.Sprintf("%d=%d", r.Address, m.Values[i])
+		}
+		line := strings.Join(patches, " ")
+		if *showOutput {
+			line += " output " + m.Output.String()
+		}
+		fmt.Println(line)
+	}
+
+	stoppedEarly := ""
+	if result.Stopped {
+		stoppedEarly = ", stopped early"
+	}
+	fmt.Fprintf(os.Stderr, "%d matches in %d of %d combinations, %d failed, in %s%s\n", len(result.Matches),
+		result.Runs, combinations, result.Failed, time.Since(start).Round(time.Millisecond), stoppedEarly)
+	if len(result.Matches) == 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParsePatchRange(t *testing.T) {
+	r, err := parsePatchRange("1=0..3")
+	assert.NoError(t, err)
+	assert.Equal(t, patchRange{Address: 1, Values: ints{0, 1, 2, 3}}, r)
+
+	r, err = parsePatchRange("12=-1,5..6,0x10")
+	assert.NoError(t, err)
+	assert.Equal(t, patchRange{Address: 12, Values: ints{-1, 5, 6, 16}}, r)
+
+	for str, expected := range map[string]string{
+		"1":                   `invalid patch range "1": missing '='`,
+		"a=1":                 `invalid patch range "a=1": invalid address`,
+		"-1=1":                `invalid patch range "-1=1": invalid address`,
+		"1=":                  `invalid patch range "1=": invalid values ""`,
+		"1=5..4":              `invalid patch range "1=5..4": invalid values "5..4"`,
+		"1=0..x":              `invalid patch range "1=0..x": invalid values "0..x"`,
+		"1=0..1e12":           `invalid patch range "1=0..1e12": invalid values "0..1e12"`,
+		"1=0..0x10000000000":  `invalid patch range "1=0..0x10000000000": too many values`,
+		"1=0..16777216":       `invalid patch range "1=0..16777216": too many values`,
+		"1=0..10,5..16777210": `invalid patch range "1=0..10,5..16777210": too many values`,
+		"1=-0x8000000000000000..0x7fffffffffffffff": `invalid patch range "1=-0x8000000000000000..0x7fffffffffffffff": too many values`,
+	} {
+		_, err := parsePatchRange(str)
+		assert.EqualError(t, err, expected, str)
+	}
+}
+
+func TestCountCombinations(t *testing.T) {
+	ranges := []patchRange{{Values: make(ints, 1<<12)}, {Values: make(ints, 1<<12)}}
+	total, err := countCombinations(ranges)
+	assert.NoError(t, err)
+	assert.Equal(t, 1<<24, total)
+
+	_, err = countCombinations(append(ranges, patchRange{Values: make(ints, 2)}))
+	assert.EqualError(t, err, "more than 16777216 combinations")
+	assert.Panics(t, func() {
+		search(nil, append(ranges, patchRange{Values: make(ints, 2)}), nil, nil, 1, 0, func(p *Program) {})
+	})
+}
+
+func TestParseSearchConditions(t *testing.T) {
+	conditions, err := parseSearchConditions("mem[0]==19690720 && out[-1] > 0x10")
+	assert.NoError(t, err)
+	assert.Equal(t, []searchCondition{
+		{Index: 0, Operator: "==", Value: 19690720},
+		{Output: true, Index: -1, Operator: ">", Value: 16},
+	}, conditions)
+
+	for str, expected := range map[string]string{
+		"mem[0]=1":     `invalid condition "mem[0]=1"`,
+		"reg[0]==1":    `invalid condition "reg[0]==1"`,
+		"mem[-1]==1":   `invalid condition "mem[-1]==1": negative address`,
+		"out[0]==x":    `invalid condition "out[0]==x": invalid syntax`,
+		"mem[0]==1 &&": `invalid condition ""`,
+	} {
+		_, err := parseSearchConditions(str)
+		assert.EqualError(t, err, expected, str)
+	}
+}
+
+func TestSearchCondition_matches(t *testing.T) {
+	memory, output := ints{5, 6}, ints{1, 2, 3}
+	for _, test := range []struct {
+		condition searchCondition
+		expected  bool
+	}{
+		{searchCondition{Index: 1, Operator: "==", Value: 6}, true},
+		{searchCondition{Index: 1, Operator: "!=", Value: 6}, false},
+		{searchCondition{Index: 0, Operator: "<", Value: 6}, true},
+		{searchCondition{Index: 0, Operator: "<=", Value: 4}, false},
+		{searchCondition{Index: 0, Operator: ">", Value: 4}, true},
+		{searchCondition{Index: 0, Operator: ">=", Value: 6}, false},
+		{searchCondition{Index: 2, Operator: "==", Value: 0}, false},
+		{searchCondition{Output: true, Index: 0, Operator: "==", Value: 1}, true},
+		{searchCondition{Output: true, Index: -1, Operator: "==", Value: 3}, true},
+		{searchCondition{Output: true, Index: -4, Operator: "==", Value: 1}, false},
+		{searchCondition{Output: true, Index: 3, Operator: "==", Value: 0}, false},
+	} {
+		assert.Equal(t, test.expected, test.condition.matches(memory, output), "%+v", test.condition)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	// Day 2 example, which outputs mem[0] before halting
+	base := New("1,11,12,3,2,3,13,0,4,0,99,30,40,50", 0).Snapshot()
+	ranges := []patchRange{
+		{Address: 1, Values: ints{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}},
+		{Address: 2, Values: ints{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}},
+	}
+	target := []searchCondition{{Index: 0, Operator: "==", Value: 3500}}
+	for _, workers := range []int{1, 4} {
+		result := search(base, ranges, nil, target, workers, 0, func(p *Program) {})
+		assert.Equal(t, 196, result.Runs)
+		assert.False(t, result.Stopped)
+		assert.Equal(t, []searchMatch{
+			{Index: 11*14 + 12, Values: ints{11, 12}, Output: ints{3500}},
+			{Index: 12*14 + 11, Values: ints{12, 11}, Output: ints{3500}},
+		}, result.Matches)
+
+		// The output matches like the memory
+		output := []searchCondition{{Output: true, Index: -1, Operator: "==", Value: 3500}}
+		result = search(base, ranges, nil, output, workers, 1, func(p *Program) {})
+		assert.True(t, result.Stopped)
+		assert.GreaterOrEqual(t, result.Runs, 11*14+13)
+		assert.Equal(t, []searchMatch{{Index: 11*14 + 12, Values: ints{11, 12}, Output: ints{3500}}}, result.Matches)
+	}
+}
+
+func TestSearch_Failed(t *testing.T) {
+	// Executes the opcode at address 1, which fails unless it is End
+	base := New("1105,1,4,0,0", 0).Snapshot()
+	ranges := []patchRange{{Address: 4, Values: ints{99, 98, 3}}}
+	result := search(base, ranges, nil, []searchCondition{{Index: 0, Operator: "!=", Value: 0}}, 2, 0,
+		func(p *Program) {})
+	assert.Equal(t, 3, result.Runs)
+	assert.Equal(t, 2, result.Failed)
+	assert.Equal(t, []searchMatch{{Index: 0, Values: ints{99}, Output: ints{}}}, result.Matches)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// selfModKind is the kind of a self-modification event.
+type selfModKind uint8
+
+const (
+	// overwriteExecuted is a write to an address, that has already been
+	// executed as an instruction or argument.
+	overwriteExecuted selfModKind = iota
+	// executeWritten is the execution of an address as an instruction or
+	// argument, that has been written by the program before.
+	executeWritten
+)
+
+func (k selfModKind) String() string {
+	if k == overwriteExecuted {
+		return "overwrite executed"
+	}
+	return "execute written"
+}
+
+// selfModEvent is a single modification of the program by itself.
+type selfModEvent struct {
+	Kind selfModKind
+	// Step is the number of instructions executed before the event.
+	Step int
+	// Address is the modified address.
+	Address int
+	// WriterIP is the IP of the instruction that has written to Address.
+	WriterIP int
+	// TargetIP is the IP of the instruction that Address belongs to.
+	TargetIP int
+}
+
+func (e selfModEvent) String() string {
+	return fmt.Sprintf("Self-modification (%s) at step %d: IP %d writes address %d of instruction at IP %d",
+		e.Kind, e.Step, e.WriterIP, e.Address, e.TargetIP)
+}
+
+// selfModTracker detects self-modifying code by tracking the executed and the
+// written addresses.
+type selfModTracker struct {
+	// executed maps an executed address to the IP of its instruction.
+	executed map[int]int
+	// written maps a written address to the IP of the writing instruction.
+	written map[int]int
+	// Events are all detected self-modifications.
+	Events []selfModEvent
+	// WarningWriter is the io.Writer where each event is written to as soon as
+	// it is detected. No warnings are written if it is nil.
+	WarningWriter io.Writer
+}
+
+func newSelfModTracker(warningWriter io.Writer) *selfModTracker {
+	return &selfModTracker{
+		executed:      map[int]int{},
+		written:       map[int]int{},
+		WarningWriter: warningWriter,
+	}
+}
+
+// execute records the execution of the instruction at Program.IP with its
+// argNum arguments.
+func (t *selfModTracker) execute(p *Program, argNum int) {
+	for address := p.IP; address <= p.IP+argNum; address++ {
+		if writerIP, ok := t.written[address]; ok {
+			t.add(selfModEvent{
+				Kind:     executeWritten,
+				Step:     p.Steps,
+				Address:  address,
+				WriterIP: writerIP,
+				TargetIP: p.IP,
+			})
+			delete(t.written, address)
+		}
+		t.executed[address] = p.IP
+	}
+}
+
+// write records the write to index by the instruction at Program.IP.
+func (t *selfModTracker) write(p *Program, index int) {
+	t.written[index] = p.IP
+	if targetIP, ok := t.executed[index]; ok {
+		t.add(selfModEvent{
+			Kind:     overwriteExecuted,
+			Step:     p.Steps,
+			Address:  index,
+			WriterIP: p.IP,
+			TargetIP: targetIP,
+		})
+	}
+}
+
+func (t *selfModTracker) add(e selfModEvent) {
+	t.Events = append(t.Events, e)
+	if t.WarningWriter != nil {
+		fmt.Fprintln(t.WarningWriter, "Warning:", e.String())
+	}
+}
+
+// String summarizes the events grouped by their kind, writer IP and target IP.
+func (t *selfModTracker) String() string {
+	type key struct {
+		Kind     selfModKind
+		WriterIP int
+		TargetIP int
+	}
+	counts := map[key]int{}
+	var keys []key
+	for _, e := range t.Events {
+		k := key{e.Kind, e.WriterIP, e.TargetIP}
+		if counts[k] == 0 {
+			keys = append(keys, k)
+		}
+		counts[k]++
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Kind != keys[j].Kind {
+			return keys[i].Kind < keys[j].Kind
+		}
+		if keys[i].WriterIP != keys[j].WriterIP {
+			return keys[i].WriterIP < keys[j].WriterIP
+		}
+		return keys[i].TargetIP < keys[j].TargetIP
+	})
+
+	str := fmt.Sprintf("%d self-modifications\n", len(t.Events))
+	for _, k := range keys {
+		str += fmt.Sprintf("  %-18s writer IP %5d  target IP %5d  %dx\n", k.Kind, k.WriterIP, k.TargetIP, counts[k])
+	}
+	return str
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSelfModTracker(t *testing.T) {
+	// The first instruction writes the end opcode to address 8, the second
+	// instruction overwrites the opcode of the first instruction
+	p := New("1101,100,-1,8,1101,0,0,0,0", 0)
+	p.SelfMod = newSelfModTracker(nil)
+	p.Exec()
+	assert.Equal(t, []selfModEvent{
+		{Kind: overwriteExecuted, Step: 1, Address: 0, WriterIP: 4, TargetIP: 0},
+		{Kind: executeWritten, Step: 2, Address: 8, WriterIP: 0, TargetIP: 8},
+	}, p.SelfMod.Events)
+	assert.Equal(t, "2 self-modifications\n"+
+		"  overwrite executed writer IP     4  target IP     0  1x\n"+
+		"  execute written    writer IP     0  target IP     8  1x\n", p.SelfMod.String())
+}
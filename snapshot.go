@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+)
+
+// pageSize is the number of ints of a memory page of a snapshot.
+const pageSize = 512
+
+// memoryPage is a page of the memory. Pages are never modified once they belong
+// to a snapshot, so that snapshots share the unmodified pages.
+type memoryPage [pageSize]int64
+
+// Snapshot is the state of a program, from which its execution can be
+// continued by Program.Restore.
+type Snapshot struct {
+	// pages are the pages of the memory. The last page is padded with zeros.
+	pages []*memoryPage
+	// memoryLen is the number of ints of the memory.
+	memoryLen int
+	CodeLen   int
+	IP        int
+	RelBase   int64
+	Finish    bool
+	Steps     int
+	Inputs    int
+	Outputs   int
+	// PendingInput is the input, which has not been read by the program yet.
+	// It is nil, if the input is read from stdin, a pipe or a socket.
+	PendingInput []byte
+	// PendingValues are the values of an input source, which have not been
+	// read by the program yet. They are nil without an input source, or if
+	// the source does not end without waiting for more input, e.g. on stdin.
+	PendingValues ints
+}
+
+// Snapshot returns the current state of the program. Only the pages written
+// since the last snapshot or restore are copied, the others are shared with
+// that snapshot. The pending input is read ahead from Program.InputSource, or
+// from Program.InputReader unless it is stdin, and is read by the program from
+// the snapshot afterwards. Input, which cannot be read without waiting for
+// more, e.g. from stdin or a pipe, is not read ahead. The buffered output is
+// flushed.
+func (p *Program) Snapshot() *Snapshot {
+	p.flushOutput()
+	s := &Snapshot{
+		pages:     make([]*memoryPage, (len(p.Ints)+pageSize-1)/pageSize),
+		memoryLen: len(p.Ints),
+		CodeLen:   p.CodeLen,
+		IP:        p.IP,
+		RelBase:   p.RelBase,
+		Finish:    p.Finish,
+		Steps:     p.Steps,
+		Inputs:    p.Inputs,
+		Outputs:   p.Outputs,
+	}
+	for i := range s.pages {
+		if p.shared(i) {
+			s.pages[i] = p.base.pages[i]
+			continue
+		}
+		s.pages[i] = &memoryPage{}
+		copy(s.pages[i][:], p.Ints[i*pageSize:])
+	}
+	if p.InputSource != nil {
+		if values, complete := p.InputSource.Pending(); complete {
+			s.PendingValues = values
+		}
+	} else if canReadAll(p.InputReader) {
+		s.PendingInput, _ = ioutil.ReadAll(p.InputReader)
+		p.InputReader = bytes.NewReader(s.PendingInput)
+	}
+	p.resetDirty(s)
+	return s
+}
+
+// Restore continues the execution of the program from the snapshot s. Only the
+// pages, which differ from the memory, are copied. The input is read from the
+// pending input of the snapshot, unless it has not been read ahead, e.g. from
+// stdin or from an input source without an end.
+func (p *Program) Restore(s *Snapshot) {
+	p.flushOutput()
+	if len(p.Ints) != s.memoryLen {
+		p.Ints = make(ints, s.memoryLen)
+		p.base = nil
+	}
+	for i, page := range s.pages {
+		if p.shared(i) && p.base.pages[i] == page {
+			continue
+		}
+		copy(p.Ints[i*pageSize:], page[:])
+	}
+	p.CodeLen = s.CodeLen
+	p.IP = s.IP
+	p.RelBase = s.RelBase
+	p.Finish = s.Finish
+	p.Steps = s.Steps
+	p.Inputs = s.Inputs
+	p.Outputs = s.Outputs
+	if s.PendingInput != nil {
+		p.InputReader = bytes.NewReader(s.PendingInput)
+	}
+	if s.PendingValues != nil {
+		p.InputSource = NewValuesInput(s.PendingValues...)
+	}
+	p.resetDirty(s)
+	// The decoded instructions may differ from the restored memory
+	p.decoded = nil
+}
+
+// Clone returns a new program with the state of the program and its own copy of
+// the whole memory, as the memory of a running program is not paged. Forking a
+// program at a decision point many times is cheaper by restoring a snapshot of
+// it, which only copies the modified pages. Neither the stats nor the
+// instrumenting features are cloned. The clone reads its own copy of the
+// pending input, but shares an input source without an end, e.g. on stdin,
+// with the program. The output sink is shared like the output writer.
+func (p *Program) Clone() *Program {
+	s := p.Snapshot()
+	c := &Program{
+		InputReader:  p.InputReader,
+		InputSource:  p.InputSource,
+		EOF:          p.EOF,
+		DebugWriter:  p.DebugWriter,
+		OutputWriter: p.OutputWriter,
+		OutputSink:   p.OutputSink,
+		Optimize:     p.Optimize,
+	}
+	c.Restore(s)
+	return c
+}
+
+// shared reports whether the memory page i is unmodified since the last
+// snapshot or restore.
+func (p *Program) shared(i int) bool {
+	return p.base != nil && i < len(p.base.pages) && i < len(p.dirty) && !p.dirty[i]
+}
+
+// resetDirty makes s the base of the memory without dirty pages.
+func (p *Program) resetDirty(s *Snapshot) {
+	p.base = s
+	if len(p.dirty) != len(s.pages) {
+		p.dirty = make([]bool, len(s.pages))
+		return
+	}
+	for i := range p.dirty {
+		p.dirty[i] = false
+	}
+}
+
+// markDirty records a write to index for the next snapshot.
+func (p *Program) markDirty(index int) {
+	if page := index / pageSize; page < len(p.dirty) {
+		p.dirty[page] = true
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// addInputs outputs the first input doubled and the sum of both inputs.
+const addInputs = "3,20,1002,20,2,21,4,21,3,22,1,20,22,23,4,23,99"
+
+func TestProgram_Restore(t *testing.T) {
+	p := New(addInputs, 10)
+	p.InputReader = strings.NewReader("3 4")
+	out := &strings.Builder{}
+	p.OutputWriter = out
+	s := p.Snapshot()
+	p.Exec()
+	assert.Equal(t, "6\n7\n", out.String())
+	executed := append(ints{}, p.Ints...)
+	steps := p.Steps
+
+	p.Restore(s)
+	assert.Equal(t, 0, p.IP)
+	assert.False(t, p.Finish)
+	assert.Equal(t, New(addInputs, 10).Ints, p.Ints)
+	out.Reset()
+	p.Exec()
+	assert.Equal(t, "6\n7\n", out.String())
+	assert.Equal(t, executed, p.Ints)
+	assert.Equal(t, steps, p.Steps)
+}
+
+func TestProgram_Restore_Memory(t *testing.T) {
+	// Write 7 far beyond the memory
+	p := New("1101,3,4,5000,99", 0)
+	s := p.Snapshot()
+	p.Exec()
+	assert.Equal(t, int64(7), p.Ints[5000])
+	grown := p.Snapshot()
+
+	p.Restore(s)
+	assert.Equal(t, ints{1101, 3, 4, 5000, 99}, p.Ints)
+	p.Restore(grown)
+	assert.Len(t, p.Ints, 5001)
+	assert.Equal(t, int64(7), p.Ints[5000])
+	assert.True(t, p.Finish)
+}
+
+func TestProgram_Snapshot_SharedPages(t *testing.T) {
+	p := New("99", 3*pageSize)
+	first := p.Snapshot()
+	p.Set(pageSize+1, 7)
+	second := p.Snapshot()
+	assert.Same(t, first.pages[0], second.pages[0])
+	assert.NotSame(t, first.pages[1], second.pages[1])
+	assert.Same(t, first.pages[2], second.pages[2])
+	assert.Equal(t, int64(0), first.pages[1][1])
+	assert.Equal(t, int64(7), second.pages[1][1])
+
+	p.Restore(first)
+	assert.Equal(t, int64(0), p.Ints[pageSize+1])
+	p.Set(2*pageSize, 8)
+	p.Restore(second)
+	assert.Equal(t, int64(7), p.Ints[pageSize+1])
+	assert.Equal(t, int64(0), p.Ints[2*pageSize])
+}
+
+func TestProgram_Clone(t *testing.T) {
+	p := New(addInputs, 10)
+	p.InputReader = strings.NewReader("3 4")
+	p.OutputWriter = &strings.Builder{}
+	c := p.Clone()
+	cloneOut := &strings.Builder{}
+	c.OutputWriter = cloneOut
+
+	c.Exec()
+	assert.Equal(t, "6\n7\n", cloneOut.String())
+	assert.Equal(t, New(addInputs, 10).Ints, p.Ints)
+	assert.Equal(t, 0, p.IP)
+
+	// The pending input is not consumed by the clone
+	p.Exec()
+	assert.Equal(t, "6\n7\n", p.OutputWriter.(*strings.Builder).String())
+	assert.Equal(t, c.Ints, p.Ints)
+}
+
+func TestProgram_Clone_SharedPages(t *testing.T) {
+	p := New("99", 3*pageSize)
+	p.Set(pageSize, 7)
+	c := p.Clone()
+	c.Set(2*pageSize, 8)
+	s := c.Snapshot()
+	assert.Same(t, p.base.pages[0], s.pages[0])
+	assert.Same(t, p.base.pages[1], s.pages[1])
+	assert.NotSame(t, p.base.pages[2], s.pages[2])
+	assert.Equal(t, int64(0), p.Ints[2*pageSize])
+}
+
+func TestProgram_Snapshot_Pipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+
+	// The pipe is not read, which would block
+	p := New(addInputs, 10)
+	p.InputReader = r
+	s := p.Snapshot()
+	assert.Nil(t, s.PendingInput)
+	p.Restore(s)
+	assert.Equal(t, r, p.InputReader)
+}
+
+func TestProgram_Clone_ASCII(t *testing.T) {
+	// Echo two characters
+	p := New("3,20,4,20,3,20,4,20,99", 10)
+	p.InputSource = NewASCIIInput(strings.NewReader("a"))
+	out := &strings.Builder{}
+	p.OutputWriter = out
+	p.OutputSink = NewASCIIOutput(out)
+	c := p.Clone()
+
+	c.Exec()
+	assert.Equal(t, "a\n", out.String())
+	p.Exec()
+	assert.Equal(t, "a\na\n", out.String())
+}
+
+func TestProgram_Snapshot_InputSource(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "input")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("3 4\n"), 0664))
+	file, err := os.Open(filename)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	p := New(addInputs, 10)
+	p.InputSource = NewChainInput(NewValuesInput(2), NewNumberInput(file))
+	out := &strings.Builder{}
+	p.OutputWriter = out
+	s := p.Snapshot()
+	assert.Equal(t, ints{2, 3, 4}, s.PendingValues)
+
+	// The source still reads the values read ahead from the file
+	p.Exec()
+	assert.Equal(t, "4\n5\n", out.String())
+	value, err := p.InputSource.ReadInput()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), value)
+
+	// Restoring rewinds the input
+	p.Restore(s)
+	out.Reset()
+	p.Exec()
+	assert.Equal(t, "4\n5\n", out.String())
+
+	// The input of stdin is not read ahead
+	p.InputSource = NewNumberInput(os.Stdin)
+	assert.Nil(t, p.Snapshot().PendingValues)
+}
+
+func BenchmarkProgram_Restore(b *testing.B) {
+	p := New("99", 1<<20)
+	s := p.Snapshot()
+	b.Run("restore", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p.Set(i%len(p.Ints), 1)
+			p.Restore(s)
+		}
+	})
+	b.Run("copy", func(b *testing.B) {
+		memory := make(ints, len(p.Ints))
+		for i := 0; i < b.N; i++ {
+			p.Set(i%len(p.Ints), 1)
+			copy(p.Ints, memory)
+		}
+	})
+}
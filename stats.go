@@ -7,49 +7,122 @@ import (
 	"time"
 )
 
-type stats struct {
-	StartTime           time.Time       `json:"-"`
-	Activated           bool            `json:"-"`
-	ExecDuration        time.Duration   `json:"exec_duration,omitempty"`
-	TotalOperations     uint            `json:"total_operations,omitempty"`
-	TimePerOperation    time.Duration   `json:"time_per_operation,omitempty"`
-	OperationsPerSecond uint            `json:"operations_per_second"`
-	Operations          map[opcode]uint `json:"operations,omitempty"`
-	TotalMemoryAccesses uint            `json:"total_memory_accesses"`
-	MemoryAccesses      map[string]uint `json:"memory_accesses"`
+// Stats contains detailed information about the program execution.
+type Stats struct {
+	StartTime              time.Time       `json:"-"`
+	Activated              bool            `json:"-"`
+	ExecDuration           time.Duration   `json:"exec_duration,omitempty"`
+	TotalOperations        uint            `json:"total_operations,omitempty"`
+	TimePerOperation       time.Duration   `json:"time_per_operation,omitempty"`
+	OperationsPerSecond    uint            `json:"operations_per_second"`
+	Operations             map[opcode]uint `json:"operations,omitempty"`
+	TotalMemoryAccesses    uint            `json:"total_memory_accesses"`
+	MemoryAccesses         map[string]uint `json:"memory_accesses"`
+	MemoryAccessesByMode   map[Mode]uint   `json:"memory_accesses_by_mode,omitempty"`
+	MemoryAccessesByOpcode map[opcode]uint `json:"memory_accesses_by_opcode,omitempty"`
+	MemoryAccessesByRegion map[string]uint `json:"memory_accesses_by_region,omitempty"`
+	MemoryGrowths          uint            `json:"memory_growths"`
+	PeakMemory             int             `json:"peak_memory"`
+	Superinstructions      map[string]uint `json:"superinstructions,omitempty"`
+	codeLen, initialMemory int
+	op                     opcode
+	// args are the arguments of the current instruction, whose accesses are
+	// counted by their mode.
+	args   [maxInstructionSize - 1]statsArg
+	argNum int
+	// resumedDuration is the duration of the execution before the program has
+	// been resumed from a checkpoint.
+	resumedDuration time.Duration
 }
 
-func (s *stats) String() string {
-	textByte, _ := json.MarshalIndent(s, "", "  ")
-	text := string(textByte)
-	text = strings.ReplaceAll(text, "\"", "")
-	text = strings.ReplaceAll(text, ",", "")
-	text = strings.ReplaceAll(text, "_", " ")
-	return text
+// String formats the stats as a text table.
+func (s *Stats) String() string {
+	var b strings.Builder
+	s.writeText(&b)
+	return b.String()
 }
 
-func newStats() stats {
-	return stats{
-		Activated:      true,
-		Operations:     map[opcode]uint{},
-		MemoryAccesses: map[string]uint{},
+// NewStats creates activated stats.
+func NewStats() Stats {
+	return Stats{
+		Activated:              true,
+		Operations:             map[opcode]uint{},
+		MemoryAccesses:         map[string]uint{},
+		MemoryAccessesByMode:   map[Mode]uint{},
+		MemoryAccessesByOpcode: map[opcode]uint{},
+		MemoryAccessesByRegion: map[string]uint{},
+		Superinstructions:      map[string]uint{},
 	}
 }
 
-// start the statistic measurements.
-func (s *stats) start() {
+// start the statistic measurements of a program with the code length codeLen
+// and the memory size memory.
+func (s *Stats) start(codeLen int, memory int) {
 	if !s.Activated {
 		return
 	}
 	s.StartTime = time.Now()
+	s.codeLen = codeLen
+	if s.initialMemory == 0 {
+		// Keep the initial memory of a resumed program
+		s.initialMemory = memory
+	}
+	if memory > s.PeakMemory {
+		s.PeakMemory = memory
+	}
+}
+
+// statsArg is an argument of an instruction, which is accessed at index.
+type statsArg struct {
+	index    int
+	mode     Mode
+	accessed bool
+}
+
+// argument records the argument i of the current instruction, which has been
+// decoded by mode to index. The arguments have to be recorded in their order.
+func (s *Stats) argument(i int, index int, mode Mode) {
+	s.args[i] = statsArg{index: index, mode: mode}
+	s.argNum = i + 1
+}
+
+// access counts a memory access of kind "Get" or "Set" to index by the current
+// instruction. An access to an argument is counted by the mode of the first
+// argument at index, which has not been accessed yet.
+func (s *Stats) access(kind string, index int) {
+	s.MemoryAccesses[kind]++
+	s.MemoryAccessesByOpcode[s.op]++
+	for i := 0; i < s.argNum; i++ {
+		if arg := &s.args[i]; arg.index == index && !arg.accessed {
+			arg.accessed = true
+			s.MemoryAccessesByMode[arg.mode]++
+			break
+		}
+	}
+	switch {
+	case index < s.codeLen:
+		s.MemoryAccessesByRegion["code"]++
+	case index < s.initialMemory:
+		s.MemoryAccessesByRegion["data"]++
+	default:
+		s.MemoryAccessesByRegion["heap"]++
+	}
+}
+
+// grow counts an increase of the memory to size.
+func (s *Stats) grow(size int) {
+	s.MemoryGrowths++
+	if size > s.PeakMemory {
+		s.PeakMemory = size
+	}
 }
 
 // stop the statistic measurements and calculate summary values.
-func (s *stats) stop() {
+func (s *Stats) stop() {
 	if !s.Activated {
 		return
 	}
-	s.ExecDuration = time.Since(s.StartTime)
+	s.ExecDuration = s.resumedDuration + time.Since(s.StartTime)
 	// Count operations
 	for _, value := range s.Operations {
 		s.TotalOperations += value
@@ -65,23 +138,40 @@ func (s *stats) stop() {
 	s.OperationsPerSecond = uint(float64(s.TotalOperations) / s.ExecDuration.Seconds())
 }
 
-func (s *stats) MarshalJSON() ([]byte, error) {
+func (s *Stats) MarshalJSON() ([]byte, error) {
 	// Convert operations to string
 	operationsString := map[string]uint{}
 	for key, value := range s.Operations {
 		operationsString[key.String()] = value
 	}
+	accessesByOpcodeString := map[string]uint{}
+	for key, value := range s.MemoryAccessesByOpcode {
+		accessesByOpcodeString[key.String()] = value
+	}
+	// Convert modes to string
+	accessesByModeString := map[string]uint{}
+	for key, value := range s.MemoryAccessesByMode {
+		accessesByModeString[key.String()] = value
+	}
 
-	type Alias stats
+	type Alias Stats
 	return json.Marshal(&struct {
 		*Alias
-		ExecDuration     string          `json:"exec_duration"`
-		TimePerOperation string          `json:"time_per_operation"`
-		Operations       map[string]uint `json:"operations,omitempty"`
+		ExecDuration           string          `json:"exec_duration"`
+		ExecDurationNanos      int64           `json:"exec_duration_ns"`
+		TimePerOperation       string          `json:"time_per_operation"`
+		TimePerOperationNanos  int64           `json:"time_per_operation_ns"`
+		Operations             map[string]uint `json:"operations,omitempty"`
+		MemoryAccessesByMode   map[string]uint `json:"memory_accesses_by_mode,omitempty"`
+		MemoryAccessesByOpcode map[string]uint `json:"memory_accesses_by_opcode,omitempty"`
 	}{
-		Alias:            (*Alias)(s),
-		ExecDuration:     s.ExecDuration.String(),
-		TimePerOperation: s.TimePerOperation.String(),
-		Operations:       operationsString,
+		Alias:                  (*Alias)(s),
+		ExecDuration:           s.ExecDuration.String(),
+		ExecDurationNanos:      s.ExecDuration.Nanoseconds(),
+		TimePerOperation:       s.TimePerOperation.String(),
+		TimePerOperationNanos:  s.TimePerOperation.Nanoseconds(),
+		Operations:             operationsString,
+		MemoryAccessesByMode:   accessesByModeString,
+		MemoryAccessesByOpcode: accessesByOpcodeString,
 	})
 }
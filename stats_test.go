@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+)
+
+func TestStats_MemoryAccesses(t *testing.T) {
+	// Adds the values at position 6 (code) and 8 (data) and writes the sum to
+	// position 10 (heap), then outputs it
+	p := New("1,6,8,10,204,10,99", 2)
+	p.OutputWriter = ioutil.Discard
+	p.Stats = NewStats()
+	p.Exec()
+
+	assert.Equal(t, map[string]uint{"Get": 3, "Set": 1}, p.Stats.MemoryAccesses)
+	assert.Equal(t, map[string]uint{"code": 1, "data": 1, "heap": 2}, p.Stats.MemoryAccessesByRegion)
+	assert.Equal(t, map[Mode]uint{0: 3, 2: 1}, p.Stats.MemoryAccessesByMode)
+	assert.Equal(t, map[opcode]uint{1: 3, 4: 1}, p.Stats.MemoryAccessesByOpcode)
+	assert.Equal(t, uint(1), p.Stats.MemoryGrowths)
+	assert.Equal(t, 11, p.Stats.PeakMemory)
+
+	var marshaled map[string]interface{}
+	text, err := json.Marshal(&p.Stats)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(text, &marshaled))
+	assert.Equal(t, map[string]interface{}{"Position": 3.0, "Relative Base": 1.0}, marshaled["memory_accesses_by_mode"])
+	assert.Equal(t, map[string]interface{}{"Add(1)": 3.0, "Output(4)": 1.0}, marshaled["memory_accesses_by_opcode"])
+	assert.Equal(t, 11.0, marshaled["peak_memory"])
+	assert.Contains(t, p.Stats.String(), "memory accesses by region\n"+
+		"  code                               1\n"+
+		"  data                               1\n"+
+		"  heap                               2\n")
+}
+
+func TestStats_MemoryAccessesByMode(t *testing.T) {
+	for source, expected := range map[string]map[Mode]uint{
+		// The jump target is not read, if the condition is false
+		"1105,0,99,1101,2,3,9,99": {0: 1, 1: 3},
+		// Every access of the same address is counted by its argument
+		"1,0,0,0,99": {0: 3},
+		// The offset of the relative base is read like any argument
+		"109,0,99": {1: 1},
+	} {
+		p := New(source, 2)
+		p.Stats = NewStats()
+		p.Exec()
+		assert.Equal(t, expected, p.Stats.MemoryAccessesByMode, source)
+	}
+}
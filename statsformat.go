@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsFormats are the functions writing the stats in a format by its name.
+var statsFormats = map[string]func(s *Stats, w io.Writer) error{
+	"text":       (*Stats).writeText,
+	"json":       (*Stats).writeJSON,
+	"csv":        (*Stats).writeCSV,
+	"prometheus": (*Stats).writePrometheus,
+}
+
+// statsFormatNames returns the sorted names of the stats formats.
+func statsFormatNames() []string {
+	names := make([]string, 0, len(statsFormats))
+	for name := range statsFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// statsMetric is a single value of the stats.
+type statsMetric struct {
+	Name string
+	Help string
+	// Label is the name of the label, which distinguishes the values of a
+	// metric with multiple values, e.g. "opcode".
+	Label string
+	// LabelValue is the value of the label, e.g. "Add(1)".
+	LabelValue string
+	Value      float64
+	// Duration indicates whether Value is a duration in seconds.
+	Duration bool
+	// Counter indicates whether the value only increases during an execution.
+	Counter bool
+}
+
+// metrics returns the stats as a list of metrics. The values of a metric with
+// a label are sorted by their label value.
+func (s *Stats) metrics() []statsMetric {
+	metrics := []statsMetric{
+		{Name: "exec_duration_seconds", Help: "Duration of the execution", Value: s.ExecDuration.Seconds(), Duration: true},
+		{Name: "operations_total", Help: "Number of executed operations", Value: float64(s.TotalOperations), Counter: true},
+		{Name: "time_per_operation_seconds", Help: "Average duration of an operation", Value: s.TimePerOperation.Seconds(), Duration: true},
+		{Name: "operations_per_second", Help: "Executed operations per second", Value: float64(s.OperationsPerSecond)},
+	}
+	operations := map[string]uint{}
+	for op, count := range s.Operations {
+		operations[op.String()] = count
+	}
+	metrics = append(metrics, labeledMetrics("operations_by_opcode_total", "Number of executed operations by opcode", "opcode", operations)...)
+	metrics = append(metrics, statsMetric{Name: "memory_accesses_total", Help: "Number of memory accesses", Value: float64(s.TotalMemoryAccesses), Counter: true})
+	metrics = append(metrics, labeledMetrics("memory_accesses_by_kind_total", "Number of memory accesses by kind", "kind", s.MemoryAccesses)...)
+	byMode := map[string]uint{}
+	for mode, count := range s.MemoryAccessesByMode {
+		byMode[mode.String()] = count
+	}
+	metrics = append(metrics, labeledMetrics("memory_accesses_by_mode_total", "Number of memory accesses by the parameter mode of the accessed argument", "mode", byMode)...)
+	byOpcode := map[string]uint{}
+	for op, count := range s.MemoryAccessesByOpcode {
+		byOpcode[op.String()] = count
+	}
+	metrics = append(metrics, labeledMetrics("memory_accesses_by_opcode_total", "Number of memory accesses by opcode", "opcode", byOpcode)...)
+	metrics = append(metrics, labeledMetrics("memory_accesses_by_region_total", "Number of memory accesses by memory region", "region", s.MemoryAccessesByRegion)...)
+	metrics = append(metrics,
+		statsMetric{Name: "memory_growths_total", Help: "Number of memory increases", Value: float64(s.MemoryGrowths), Counter: true},
+		statsMetric{Name: "peak_memory_ints", Help: "Maximum memory size in ints", Value: float64(s.PeakMemory)},
+	)
+	metrics = append(metrics, labeledMetrics("superinstructions_total", "Number of executed superinstructions of the optimizer", "kind", s.Superinstructions)...)
+	return metrics
+}
+
+// labeledMetrics returns a metric for each value of values, sorted by the label
+// value.
+func labeledMetrics(name string, help string, label string, values map[string]uint) []statsMetric {
+	labelValues := make([]string, 0, len(values))
+	for labelValue := range values {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+	metrics := make([]statsMetric, len(labelValues))
+	for i, labelValue := range labelValues {
+		metrics[i] = statsMetric{
+			Name:       name,
+			Help:       help,
+			Label:      label,
+			LabelValue: labelValue,
+			Value:      float64(values[labelValue]),
+			Counter:    true,
+		}
+	}
+	return metrics
+}
+
+// formatValue formats the value of the metric. Durations are formatted as
+// time.Duration, if humanReadable is set.
+func (m statsMetric) formatValue(humanReadable bool) string {
+	if m.Duration && humanReadable {
+		return time.Duration(m.Value * float64(time.Second)).String()
+	}
+	return strconv.FormatFloat(m.Value, 'f', -1, 64)
+}
+
+// title returns the name of the metric without its unit in a readable form.
+func (m statsMetric) title() string {
+	title := m.Name
+	for _, suffix := range []string{"_seconds", "_total", "_ints"} {
+		title = strings.TrimSuffix(title, suffix)
+	}
+	return strings.ReplaceAll(title, "_", " ")
+}
+
+// writeText writes the stats as a table to w. The values of a metric with a
+// label are listed indented below the title of the metric.
+func (s *Stats) writeText(w io.Writer) error {
+	lastName := ""
+	for _, m := range s.metrics() {
+		if m.Label == "" {
+			fmt.Fprintf(w, "%-36s %s\n", m.title(), m.formatValue(true))
+			continue
+		}
+		if m.Name != lastName {
+			fmt.Fprintln(w, m.title())
+			lastName = m.Name
+		}
+		fmt.Fprintf(w, "  %-34s %s\n", m.LabelValue, m.formatValue(true))
+	}
+	return nil
+}
+
+// writeJSON writes the stats as indented JSON to w.
+func (s *Stats) writeJSON(w io.Writer) error {
+	text, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(text))
+	return err
+}
+
+// writeCSV writes the stats as CSV with the columns metric, label, label value
+// and value to w.
+func (s *Stats) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"metric", "label", "label_value", "value"})
+	for _, m := range s.metrics() {
+		writer.Write([]string{m.Name, m.Label, m.LabelValue, m.formatValue(false)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// prometheusPrefix is the prefix of all metric names in the Prometheus format.
+const prometheusPrefix = "intcode_"
+
+// writePrometheus writes the stats in the Prometheus text exposition format
+// to w.
+func (s *Stats) writePrometheus(w io.Writer) error {
+	lastName := ""
+	for _, m := range s.metrics() {
+		name := prometheusPrefix + m.Name
+		if m.Name != lastName {
+			metricType := "gauge"
+			if m.Counter {
+				metricType = "counter"
+			}
+			fmt.Fprintf(w, "# HELP %s %s\n", name, m.Help)
+			fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+			lastName = m.Name
+		}
+		if m.Label != "" {
+			name += "{" + m.Label + "=" + strconv.Quote(m.LabelValue) + "}"
+		}
+		if _, err := fmt.Fprintln(w, name, m.formatValue(false)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// testStats returns stats with fixed values.
+func testStats() *Stats {
+	s := NewStats()
+	s.ExecDuration = 2 * time.Millisecond
+	s.TotalOperations = 4
+	s.TimePerOperation = 500 * time.Microsecond
+	s.OperationsPerSecond = 2000
+	s.Operations[1] = 3
+	s.Operations[99] = 1
+	s.TotalMemoryAccesses = 9
+	s.MemoryAccesses["Get"] = 6
+	s.MemoryAccesses["Set"] = 3
+	s.PeakMemory = 10
+	return &s
+}
+
+func TestStats_WriteText(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, testStats().writeText(&out))
+	assert.Equal(t, "exec duration                        2ms\n"+
+		"operations                           4\n"+
+		"time per operation                   500µs\n"+
+		"operations per second                2000\n"+
+		"operations by opcode\n"+
+		"  Add(1)                             3\n"+
+		"  End(99)                            1\n"+
+		"memory accesses                      9\n"+
+		"memory accesses by kind\n"+
+		"  Get                                6\n"+
+		"  Set                                3\n"+
+		"memory growths                       0\n"+
+		"peak memory                          10\n", out.String())
+}
+
+func TestStats_WriteJSON(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, testStats().writeJSON(&out))
+	var values map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &values))
+	assert.Equal(t, "2ms", values["exec_duration"])
+	assert.Equal(t, 2e6, values["exec_duration_ns"])
+	assert.Equal(t, map[string]interface{}{"Add(1)": 3.0, "End(99)": 1.0}, values["operations"])
+}
+
+func TestStats_WriteCSV(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, testStats().writeCSV(&out))
+	records, err := csv.NewReader(&out).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"metric", "label", "label_value", "value"}, records[0])
+	assert.Equal(t, []string{"exec_duration_seconds", "", "", "0.002"}, records[1])
+	assert.Equal(t, []string{"operations_by_opcode_total", "opcode", "Add(1)", "3"}, records[5])
+}
+
+func TestStats_WritePrometheus(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, testStats().writePrometheus(&out))
+	assert.Contains(t, out.String(), "# HELP intcode_operations_by_opcode_total Number of executed operations by opcode\n"+
+		"# TYPE intcode_operations_by_opcode_total counter\n"+
+		"intcode_operations_by_opcode_total{opcode=\"Add(1)\"} 3\n"+
+		"intcode_operations_by_opcode_total{opcode=\"End(99)\"} 1\n")
+	assert.Contains(t, out.String(), "# TYPE intcode_peak_memory_ints gauge\nintcode_peak_memory_ints 10\n")
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// traceMemoryPrefix marks the last line of a trace, which contains the memory
+// after the program has finished.
+const traceMemoryPrefix = "memory"
+
+// traceStep is a single executed instruction of a trace.
+type traceStep struct {
+	// Step is the number of instructions executed before this one.
+	Step int `json:"step"`
+	// IP is the instruction pointer of the instruction.
+	IP int `json:"ip"`
+	// RelBase is the value of the relative base register before the execution.
+	RelBase int64 `json:"rel_base"`
+	// Raw are the opcode and the raw arguments of the instruction before the
+	// execution.
+	Raw ints `json:"raw"`
+}
+
+// trace is a recorded program execution, i.e. all executed instructions and
+// the memory after the program has finished.
+type trace struct {
+	Steps []traceStep
+	// Memory is the memory after the program has finished. It is nil, if the
+	// program did not finish.
+	Memory ints
+}
+
+// String formats the step as one line of a trace: "<step> <ip> <relbase> <raw>".
+func (s traceStep) String() string {
+	return fmt.Sprintf("%d %d %d %s", s.Step, s.IP, s.RelBase, s.Raw.String())
+}
+
+// equal reports whether two steps executed the same instruction in the same state.
+func (s traceStep) equal(o traceStep) bool {
+	return s.IP == o.IP && s.RelBase == o.RelBase && s.Raw.String() == o.Raw.String()
+}
+
+// traceInstruction writes the instruction at Program.IP to Program.TraceWriter.
+func (p *Program) traceInstruction(op opcode) {
+	end := p.IP + 1 + opcodes[op].ArgNum
+	if end > len(p.Ints) {
+		end = len(p.Ints)
+	}
+	step := traceStep{
+		Step:    p.Steps,
+		IP:      p.IP,
+		RelBase: p.RelBase,
+		Raw:     p.Ints[p.IP:end],
+	}
+	fmt.Fprintln(p.TraceWriter, step.String())
+}
+
+// traceMemory writes the memory to Program.TraceWriter, which ends the trace.
+func (p *Program) traceMemory() {
+	fmt.Fprintln(p.TraceWriter, traceMemoryPrefix, p.Ints.String())
+}
+
+// readTrace parses a trace written by Program.TraceWriter.
+func readTrace(r io.Reader) (*trace, error) {
+	t := &trace{}
+	reader := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line != "" {
+			if parseErr := t.parseLine(line); parseErr != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, parseErr)
+			}
+		}
+		if err == io.EOF {
+			return t, nil
+		}
+	}
+}
+
+// parseLine parses a single line of a trace and adds it to the trace.
+func (t *trace) parseLine(line string) error {
+	fields := strings.Fields(line)
+	if fields[0] == traceMemoryPrefix {
+		if len(fields) != 2 {
+			return errors.New("invalid memory line")
+		}
+		var err error
+		t.Memory, err = parseInts(fields[1])
+		return err
+	}
+
+	if len(fields) != 4 {
+		return errors.New("invalid step line")
+	}
+	var step traceStep
+	var err error
+	if step.Step, err = strconv.Atoi(fields[0]); err != nil {
+		return err
+	}
+	if step.IP, err = strconv.Atoi(fields[1]); err != nil {
+		return err
+	}
+	if step.RelBase, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return err
+	}
+	if step.Raw, err = parseInts(fields[3]); err != nil {
+		return err
+	}
+	t.Steps = append(t.Steps, step)
+	return nil
+}
+
+// traceDiff is the result of comparing two traces.
+type traceDiff struct {
+	A, B *trace
+	// FirstStep is the index of the first step that differs, or -1 if all
+	// steps are equal.
+	FirstStep int
+	// MemoryAddresses are the addresses whose values differ at the end.
+	MemoryAddresses []int
+}
+
+// diffTraces compares the traces a and b.
+func diffTraces(a, b *trace) *traceDiff {
+	d := &traceDiff{A: a, B: b, FirstStep: -1}
+	for i := 0; i < len(a.Steps) || i < len(b.Steps); i++ {
+		if i >= len(a.Steps) || i >= len(b.Steps) || !a.Steps[i].equal(b.Steps[i]) {
+			d.FirstStep = i
+			break
+		}
+	}
+	d.MemoryAddresses = diffMemory(a.Memory, b.Memory)
+	return d
+}
+
+// diffMemory returns the addresses whose values differ in a and b. Missing
+// values of the shorter memory are considered zero.
+func diffMemory(a, b ints) []int {
+	var addresses []int
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if memoryValue(a, i) != memoryValue(b, i) {
+			addresses = append(addresses, i)
+		}
+	}
+	return addresses
+}
+
+// memoryValue returns the value at index, or zero if index is out of range.
+func memoryValue(memory ints, index int) int64 {
+	if index < len(memory) {
+		return memory[index]
+	}
+	return 0
+}
+
+// differs reports whether the traces differ in any step or memory address.
+func (d *traceDiff) differs() bool {
+	return d.FirstStep >= 0 || len(d.MemoryAddresses) > 0
+}
+
+// print writes a report of the differences to w. context many steps are shown
+// before and after the first differing step.
+func (d *traceDiff) print(w io.Writer, context int) {
+	if d.FirstStep < 0 {
+		fmt.Fprintf(w, "All %d steps are equal\n", len(d.A.Steps))
+	} else {
+		fmt.Fprintf(w, "First difference at step %d:\n", d.FirstStep)
+		start := d.FirstStep - context
+		if start < 0 {
+			start = 0
+		}
+		for i := start; i < d.FirstStep; i++ {
+			fmt.Fprintln(w, " ", d.A.Steps[i].String())
+		}
+		d.printSteps(w, "a", d.A, context)
+		d.printSteps(w, "b", d.B, context)
+	}
+
+	if d.A.Memory == nil || d.B.Memory == nil {
+		fmt.Fprintln(w, "Memory not compared, as not both programs finished")
+		return
+	}
+	if len(d.MemoryAddresses) == 0 {
+		fmt.Fprintln(w, "Memory is equal")
+		return
+	}
+	fmt.Fprintf(w, "Memory differs at %d addresses:\n", len(d.MemoryAddresses))
+	for _, address := range d.MemoryAddresses {
+		fmt.Fprintf(w, "  %d: %d != %d\n", address, memoryValue(d.A.Memory, address), memoryValue(d.B.Memory, address))
+	}
+}
+
+// printSteps writes the first differing step of t and context many steps after
+// it to w, each line starting with prefix.
+func (d *traceDiff) printSteps(w io.Writer, prefix string, t *trace, context int) {
+	for i := d.FirstStep; i <= d.FirstStep+context; i++ {
+		if i >= len(t.Steps) {
+			fmt.Fprintln(w, prefix, "<end of trace>")
+			return
+		}
+		fmt.Fprintln(w, prefix, t.Steps[i].String())
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// recordTrace executes the program str and returns its parsed trace.
+func recordTrace(t *testing.T, str string) *trace {
+	p := New(str, 0)
+	p.OutputWriter = ioutil.Discard
+	var buf bytes.Buffer
+	p.TraceWriter = &buf
+	p.Exec()
+	tr, err := readTrace(&buf)
+	assert.NoError(t, err)
+	return tr
+}
+
+func TestProgram_Trace(t *testing.T) {
+	tr := recordTrace(t, "1101,5,8,7,4,7,99,0")
+	assert.Equal(t, []traceStep{
+		{Step: 0, IP: 0, RelBase: 0, Raw: ints{1101, 5, 8, 7}},
+		{Step: 1, IP: 4, RelBase: 0, Raw: ints{4, 7}},
+		{Step: 2, IP: 6, RelBase: 0, Raw: ints{99}},
+	}, tr.Steps)
+	assert.Equal(t, ints{1101, 5, 8, 7, 4, 7, 99, 13}, tr.Memory)
+}
+
+func TestReadTrace_Invalid(t *testing.T) {
+	_, err := readTrace(strings.NewReader("0 0 0 99\n1 a 0 99\n"))
+	assert.EqualError(t, err, "line 2: strconv.Atoi: parsing \"a\": invalid syntax")
+}
+
+func TestDiffTraces(t *testing.T) {
+	a := recordTrace(t, "1101,5,8,7,4,7,99,0")
+	d := diffTraces(a, a)
+	assert.False(t, d.differs())
+	assert.Equal(t, -1, d.FirstStep)
+
+	b := recordTrace(t, "1101,5,9,7,4,7,99,0")
+	d = diffTraces(a, b)
+	assert.True(t, d.differs())
+	assert.Equal(t, 0, d.FirstStep)
+	assert.Equal(t, []int{2, 7}, d.MemoryAddresses)
+
+	var out bytes.Buffer
+	d.print(&out, 1)
+	assert.Equal(t, "First difference at step 0:\n"+
+		"a 0 0 0 1101,5,8,7\n"+
+		"a 1 4 0 4,7\n"+
+		"b 0 0 0 1101,5,9,7\n"+
+		"b 1 4 0 4,7\n"+
+		"Memory differs at 2 addresses:\n"+
+		"  2: 8 != 9\n"+
+		"  7: 13 != 14\n", out.String())
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// traceDiffCommand compares two traces, either read from trace files or
+// recorded by running two programs side by side, and reports the first
+// differing step. It exits with status 1 if the traces differ.
+func traceDiffCommand(args []string) {
+	fs := flag.NewFlagSet("tracediff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s tracediff <flags> <a> <b>\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	context := fs.Int("context", 3, "Number of steps shown before and after the first difference")
+	run := fs.Bool("run", false, "Run <a> and <b> as programs instead of reading them as trace files")
+	inputA := fs.String("input-a", "", "File to read input values of program <a> from, if -run is set")
+	inputB := fs.String("input-b", "", "File to read input values of program <b> from, if -run is set")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var a, b *trace
+	if *run {
+		a = runTrace(fs.Arg(0), *inputA)
+		b = runTrace(fs.Arg(1), *inputB)
+	} else {
+		a = openTrace(fs.Arg(0))
+		b = openTrace(fs.Arg(1))
+	}
+
+	d := diffTraces(a, b)
+	d.print(os.Stdout, *context)
+	if d.differs() {
+		os.Exit(1)
+	}
+}
+
+// openTrace reads the trace file filename.
+func openTrace(filename string) *trace {
+	file, err := os.Open(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer file.Close()
+	t, err := readTrace(file)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", filename, err))
+	}
+	return t
+}
+
+// runTrace executes the program in programFilename and records its trace. The
+// input is read from inputFilename, or from stdin if it is empty. The output of
+// the program is discarded.
+func runTrace(programFilename string, inputFilename string) *trace {
+	p, closeInput := loadProgram(programFilename, inputFilename)
+	defer closeInput()
+	p.OutputWriter = ioutil.Discard
+	var buf bytes.Buffer
+	p.TraceWriter = &buf
+	p.Exec()
+
+	t, err := readTrace(&buf)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
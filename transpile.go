@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// transpilers write a program as source code of a language by its name.
+var transpilers = map[string]func(w io.Writer, a *transpileAnalysis) error{
+	"c":  transpileC,
+	"go": transpileGo,
+}
+
+// transpilerNames returns the sorted names of the transpiler languages.
+func transpilerNames() []string {
+	names := make([]string, 0, len(transpilers))
+	for name := range transpilers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// transpiledInstruction is an instruction found by analyzeProgram.
+type transpiledInstruction struct {
+	Address int
+	Op      opcode
+	Modes   []Mode
+	Args    ints
+	// Text is the disassembled instruction.
+	Text string
+}
+
+// Next returns the address of the following instruction.
+func (ins transpiledInstruction) Next() int {
+	return ins.Address + 1 + len(ins.Args)
+}
+
+// transpileAnalysis contains the instructions of a program, which can be
+// transpiled. The remaining code is executed by an interpreter embedded into
+// the transpiled program.
+type transpileAnalysis struct {
+	// Name is the name of the program, e.g. its file name.
+	Name string
+	// Memory is the initial memory of the program, i.e. the code followed by
+	// the additional memory.
+	Memory ints
+	// Instructions are the transpiled instructions sorted by address.
+	Instructions []transpiledInstruction
+	// CodeCells marks the addresses of the ints of the transpiled instructions.
+	// Writing to them is self-modifying code, so that the transpiled program
+	// continues in the interpreter.
+	CodeCells []bool
+}
+
+// analyzeProgram finds the instructions of the program, which are reachable
+// from address 0 by continuing after each instruction except End and by jumps
+// to immediate addresses. The search stops at values, that are no valid
+// instruction.
+func analyzeProgram(name string, memory ints, codeLen int) *transpileAnalysis {
+	a := &transpileAnalysis{Name: name, Memory: memory, CodeCells: make([]bool, codeLen)}
+	code := memory[:codeLen]
+	visited := map[int]bool{}
+	work := []int{0}
+	for len(work) > 0 {
+		address := work[len(work)-1]
+		work = work[:len(work)-1]
+		if address < 0 || address >= len(code) || visited[address] {
+			continue
+		}
+		visited[address] = true
+		ins, ok := decodeStatic(code, address)
+		if !ok {
+			continue
+		}
+		a.Instructions = append(a.Instructions, ins)
+		for i := address; i < ins.Next(); i++ {
+			a.CodeCells[i] = true
+		}
+		if ins.Op != 99 {
+			work = append(work, ins.Next())
+		}
+		if (ins.Op == 5 || ins.Op == 6) && ins.Modes[1] == 1 {
+			work = append(work, int(ins.Args[1]))
+		}
+	}
+	sort.Slice(a.Instructions, func(i, j int) bool {
+		return a.Instructions[i].Address < a.Instructions[j].Address
+	})
+	return a
+}
+
+// decodeStatic decodes the instruction at address of code. It reports false, if
+// the value is no known opcode with valid modes or the arguments exceed the
+// code.
+func decodeStatic(code ints, address int) (transpiledInstruction, bool) {
+	raw := code[address]
+	if raw < 0 {
+		return transpiledInstruction{}, false
+	}
+	op := newOpcode(raw)
+	if int(op) >= len(opcodes) || opcodes[op].Fn == nil {
+		return transpiledInstruction{}, false
+	}
+	argNum := opcodes[op].ArgNum
+	if address+argNum >= len(code) {
+		return transpiledInstruction{}, false
+	}
+	modes := NewModeList(raw, argNum)
+	for _, mode := range modes {
+		if int(mode) >= len(Modes) {
+			return transpiledInstruction{}, false
+		}
+	}
+	text, _ := disassembleInstruction(code, address)
+	return transpiledInstruction{
+		Address: address,
+		Op:      op,
+		Modes:   modes,
+		Args:    code[address+1 : address+1+argNum],
+		Text:    text,
+	}, true
+}
+
+// transpileCommand transpiles a program into the source code of a language.
+func transpileCommand(args []string) {
+	fs := flag.NewFlagSet("transpile", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s transpile <flags> <program>\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Flags:")
+		fs.PrintDefaults()
+	}
+	lang := fs.String("lang", "go", "Language to transpile to ("+strings.Join(transpilerNames(), ", ")+")")
+	outputFilename := fs.String("o", "", "File to write the source code to instead of stdout")
+	memory := fs.Uint("mem", 42, "Number of ints that are allocated for the memory in addition to the program")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	transpile, ok := transpilers[*lang]
+	if !ok {
+		panic("Unknown language " + *lang)
+	}
+
+	source, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	p := New(string(source), *memory)
+	a := analyzeProgram(fs.Arg(0), p.Ints, p.CodeLen)
+
+	w := io.Writer(os.Stdout)
+	if *outputFilename != "" {
+		file, err := os.OpenFile(*outputFilename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+		if err != nil {
+			panic(err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := transpile(w, a); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var cTemplate = template.Must(template.New("c").Parse(`/* Code generated by intcode transpile from {{.Name}}. DO NOT EDIT. */
+
+#include <inttypes.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <time.h>
+
+/* code is the transpiled program. */
+static const int64_t code[] = {
+{{.Code -}}
+};
+
+#define CODE_LEN {{.CodeLen}}
+
+/* MEMORY_SIZE is the number of ints of the initial memory. */
+#define MEMORY_SIZE {{.MemorySize}}
+
+/* code_cells marks the ints of the transpiled instructions with '1'. Writing to
+ * them continues the execution in the interpreter. */
+static const char code_cells[] = "{{.CodeCells}}";
+
+/* arg_nums are the number of arguments by opcode, or -1 for unknown opcodes. */
+static const int arg_nums[100] = { {{- .ArgNums -}} };
+
+static int64_t *mem;
+static int64_t mem_len;
+static int64_t rb;
+static int self_modified;
+static int64_t inputs;
+
+static void fail(const char *message, int64_t value) {
+	fflush(stdout);
+	fprintf(stderr, "%s %" PRId64 "\n", message, value);
+	exit(2);
+}
+
+static void grow(int64_t i) {
+	int64_t *grown = realloc(mem, (size_t)(i + 1) * sizeof(int64_t));
+	if (grown == NULL) {
+		fail("out of memory for address", i);
+	}
+	memset(grown + mem_len, 0, (size_t)(i + 1 - mem_len) * sizeof(int64_t));
+	mem = grown;
+	mem_len = i + 1;
+}
+
+static int64_t get(int64_t i) {
+	if (i < 0) {
+		fail("negative address", i);
+	}
+	if (i >= mem_len) {
+		grow(i);
+	}
+	return mem[i];
+}
+
+static void set(int64_t i, int64_t v) {
+	if (i < 0) {
+		fail("negative address", i);
+	}
+	if (i >= mem_len) {
+		grow(i);
+	}
+	if (i < CODE_LEN && code_cells[i] == '1' && mem[i] != v) {
+		self_modified = 1;
+	}
+	mem[i] = v;
+}
+
+static int64_t input(void) {
+	int64_t v;
+	if (scanf("%" SCNd64, &v) != 1) {
+		fail("invalid input after number of inputs", inputs);
+	}
+	inputs++;
+	return v;
+}
+
+static void output(int64_t v) {
+	printf("%" PRId64 "\n", v);
+}
+
+/* The arithmetic wraps around and fails like in Go, instead of being undefined. */
+
+static int64_t add(int64_t x, int64_t y) {
+	return (int64_t)((uint64_t)x + (uint64_t)y);
+}
+
+static int64_t mul(int64_t x, int64_t y) {
+	return (int64_t)((uint64_t)x * (uint64_t)y);
+}
+
+static int64_t divide(int64_t x, int64_t y) {
+	if (y == 0) {
+		fail("integer divide by zero of", x);
+	}
+	if (y == -1) {
+		return (int64_t)(0 - (uint64_t)x);
+	}
+	return x / y;
+}
+
+static int64_t mod(int64_t x, int64_t y) {
+	if (y == 0) {
+		fail("integer divide by zero of", x);
+	}
+	if (y == -1) {
+		return 0;
+	}
+	return x % y;
+}
+
+static int64_t shl(int64_t x, int64_t y) {
+	if (y < 0) {
+		fail("negative shift amount", y);
+	}
+	if (y >= 64) {
+		return 0;
+	}
+	return (int64_t)((uint64_t)x << y);
+}
+
+static int64_t shr(int64_t x, int64_t y) {
+	if (y < 0) {
+		fail("negative shift amount", y);
+	}
+	if (y >= 64) {
+		return x < 0 ? -1 : 0;
+	}
+	return x < 0 ? ~(~x >> y) : x >> y;
+}
+
+static int64_t absolute(int64_t v) {
+	return v < 0 ? (int64_t)(0 - (uint64_t)v) : v;
+}
+
+static int64_t random63(void) {
+	int64_t v = 0;
+	int i;
+	for (i = 0; i < 4; i++) {
+		v = (v << 16) ^ (rand() & 0xffff);
+	}
+	return v & INT64_MAX;
+}
+
+/* interpret executes the program starting at ip. */
+static void interpret(int64_t ip) {
+	while (ip < mem_len) {
+		int64_t ins, op, modes, next;
+		int64_t a[3] = {0, 0, 0};
+		int n, i;
+		if (ip < 0) {
+			fail("negative address", ip);
+		}
+		ins = mem[ip];
+		op = ins % 100;
+		modes = ins / 100;
+		if (op < 0 || arg_nums[op] < 0) {
+			fail("unknown opcode at", ip);
+		}
+		n = arg_nums[op];
+		if (ip + n >= mem_len) {
+			fail("not enough arguments at", ip);
+		}
+		for (i = 0; i < n; i++) {
+			switch (modes % 10) {
+			case 0:
+				a[i] = mem[ip + 1 + i];
+				break;
+			case 1:
+				a[i] = ip + 1 + i;
+				break;
+			case 2:
+				a[i] = add(rb, mem[ip + 1 + i]);
+				break;
+			default:
+				fail("unknown mode at", ip);
+			}
+			modes /= 10;
+		}
+		next = ip + 1 + n;
+		switch (op) {
+		case 1: set(a[2], add(get(a[0]), get(a[1]))); break;
+		case 2: set(a[2], mul(get(a[0]), get(a[1]))); break;
+		case 3: set(a[0], input()); break;
+		case 4: output(get(a[0])); break;
+		case 5: if (get(a[0]) != 0) next = get(a[1]); break;
+		case 6: if (get(a[0]) == 0) next = get(a[1]); break;
+		case 7: set(a[2], get(a[0]) < get(a[1])); break;
+		case 8: set(a[2], get(a[0]) == get(a[1])); break;
+		case 9: rb = add(rb, get(a[0])); break;
+		case 10: set(a[2], get(a[0]) & get(a[1])); break;
+		case 11: set(a[2], get(a[0]) | get(a[1])); break;
+		case 12: set(a[2], get(a[0]) ^ get(a[1])); break;
+		case 13: set(a[2], divide(get(a[0]), get(a[1]))); break;
+		case 14: set(a[2], mod(get(a[0]), get(a[1]))); break;
+		case 15: set(a[2], shl(get(a[0]), get(a[1]))); break;
+		case 16: set(a[2], shr(get(a[0]), get(a[1]))); break;
+		case 17: set(a[1], get(a[0]) == 0); break;
+		case 18: set(a[0], (int64_t)time(NULL)); break;
+		case 19: set(a[0], random63()); break;
+		case 20: set(a[1], absolute(get(a[0]))); break;
+		case 99: return;
+		}
+		ip = next;
+	}
+}
+
+/* run executes the transpiled instructions until the program ends, modifies its
+ * code or jumps to an address without a transpiled instruction. Then the
+ * execution continues in the interpreter. */
+static void run(void) {
+	int64_t ip = 0;
+	while (!self_modified) {
+		switch (ip) {
+{{.Cases}}		default:
+			interpret(ip);
+			return;
+		}
+	}
+	interpret(ip);
+}
+
+int main(void) {
+	mem = calloc(MEMORY_SIZE, sizeof(int64_t));
+	if (mem == NULL) {
+		fail("out of memory for address", MEMORY_SIZE - 1);
+	}
+	mem_len = MEMORY_SIZE;
+	memcpy(mem, code, sizeof(code));
+	srand((unsigned)time(NULL));
+	run();
+	return 0;
+}
+`))
+
+// cFunctions are the C functions of the instructions with two operands and a
+// result.
+var cFunctions = map[opcode]string{
+	1: "add", 2: "mul", 13: "divide", 14: "mod", 15: "shl", 16: "shr",
+}
+
+// cOperators are the C operators of the instructions with two operands and a
+// result, which cannot overflow.
+var cOperators = map[opcode]string{
+	7: "<", 8: "==", 10: "&", 11: "|", 12: "^",
+}
+
+// transpileC writes the program as a standalone C99 program, which reads the
+// input from stdin and writes the output to stdout like transpileGo.
+func transpileC(w io.Writer, a *transpileAnalysis) error {
+	var cases strings.Builder
+	for _, ins := range a.Instructions {
+		fmt.Fprintf(&cases, "\t\tcase %d: /* %s */\n", ins.Address, ins.Text)
+		for _, line := range strings.SplitAfter(cInstruction(ins), "\n") {
+			if line != "" {
+				cases.WriteString("\t\t\t" + line)
+			}
+		}
+	}
+
+	var codeCells strings.Builder
+	for _, isCode := range a.CodeCells {
+		codeCells.WriteByte("01"[boolToInt(isCode)])
+	}
+	argNums := make([]string, 100)
+	for op := range argNums {
+		argNums[op] = "-1"
+		if op < len(opcodes) && opcodes[op].Fn != nil {
+			argNums[op] = strconv.Itoa(opcodes[op].ArgNum)
+		}
+	}
+	code := make([]string, len(a.CodeCells))
+	for i, v := range a.Memory[:len(a.CodeCells)] {
+		code[i] = cInt(v)
+	}
+
+	var b bytes.Buffer
+	err := cTemplate.Execute(&b, struct {
+		Name       string
+		Code       string
+		CodeLen    int
+		MemorySize int
+		CodeCells  string
+		ArgNums    string
+		Cases      string
+	}{
+		Name:       strings.ReplaceAll(a.Name, "*/", "* /"),
+		Code:       wrapStrings(code, 8, "\t"),
+		CodeLen:    len(a.CodeCells),
+		MemorySize: len(a.Memory),
+		CodeCells:  codeCells.String(),
+		ArgNums:    strings.Join(argNums, ", "),
+		Cases:      cases.String(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// cInt returns v as a C int64_t constant.
+func cInt(v int64) string {
+	if v == math.MinInt64 {
+		return "INT64_MIN"
+	}
+	return "INT64_C(" + strconv.FormatInt(v, 10) + ")"
+}
+
+// wrapStrings joins the values by commas into lines of perLine many values,
+// each starting with indent.
+func wrapStrings(values []string, perLine int, indent string) string {
+	var b strings.Builder
+	for i := 0; i < len(values); i += perLine {
+		end := i + perLine
+		if end > len(values) {
+			end = len(values)
+		}
+		b.WriteString(indent + strings.Join(values[i:end], ", ") + ",\n")
+	}
+	return b.String()
+}
+
+// cInstruction returns the C statements of the instruction, which end by
+// setting ip to the next instruction and breaking or by returning.
+func cInstruction(ins transpiledInstruction) string {
+	read := func(i int) string {
+		switch ins.Modes[i] {
+		case 1:
+			return cInt(ins.Args[i])
+		case 2:
+			return "get(add(rb, " + cInt(ins.Args[i]) + "))"
+		default:
+			return "get(" + cInt(ins.Args[i]) + ")"
+		}
+	}
+	write := func(i int) string {
+		switch ins.Modes[i] {
+		case 1:
+			return cInt(int64(ins.Address + 1 + i))
+		case 2:
+			return "add(rb, " + cInt(ins.Args[i]) + ")"
+		default:
+			return cInt(ins.Args[i])
+		}
+	}
+	next := fmt.Sprintf("ip = %d;\nbreak;\n", ins.Next())
+
+	if function, ok := cFunctions[ins.Op]; ok {
+		return fmt.Sprintf("set(%s, %s(%s, %s));\n", write(2), function, read(0), read(1)) + next
+	}
+	if operator, ok := cOperators[ins.Op]; ok {
+		return fmt.Sprintf("set(%s, %s %s %s);\n", write(2), read(0), operator, read(1)) + next
+	}
+	switch ins.Op {
+	case 3:
+		return fmt.Sprintf("set(%s, input());\n", write(0)) + next
+	case 4:
+		return fmt.Sprintf("output(%s);\n", read(0)) + next
+	case 5, 6:
+		condition := "!="
+		if ins.Op == 6 {
+			condition = "=="
+		}
+		return fmt.Sprintf("if (%s %s 0) {\n\tip = %s;\n\tbreak;\n}\n", read(0), condition, read(1)) + next
+	case 9:
+		return fmt.Sprintf("rb = add(rb, %s);\n", read(0)) + next
+	case 17:
+		return fmt.Sprintf("set(%s, %s == 0);\n", write(1), read(0)) + next
+	case 18:
+		return fmt.Sprintf("set(%s, (int64_t)time(NULL));\n", write(0)) + next
+	case 19:
+		return fmt.Sprintf("set(%s, random63());\n", write(0)) + next
+	case 20:
+		return fmt.Sprintf("set(%s, absolute(%s));\n", write(1), read(0)) + next
+	case 99:
+		return "return;\n"
+	default:
+		// Syscall does nothing
+		return next
+	}
+}
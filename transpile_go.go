@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+var goTemplate = template.Must(template.New("go").Parse(`// Code generated by intcode transpile from {{.Name}}. DO NOT EDIT.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// code is the transpiled program.
+var code = []int64{
+{{.Code}}
+}
+
+// memorySize is the number of ints of the initial memory.
+const memorySize = {{.MemorySize}}
+
+// codeCells marks the ints of the transpiled instructions with '1'. Writing
+// to them continues the execution in the interpreter.
+const codeCells = "{{.CodeCells}}"
+
+// argNums are the number of arguments by opcode.
+var argNums = map[int64]int{ {{- .ArgNums -}} }
+
+// machine is the state of the program.
+type machine struct {
+	mem          []int64
+	rb           int64
+	in           io.Reader
+	out          io.Writer
+	selfModified bool
+}
+
+func main() {
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	newMachine(os.Stdin, out).run()
+}
+
+func newMachine(in io.Reader, out io.Writer) *machine {
+	mem := make([]int64, memorySize)
+	copy(mem, code)
+	return &machine{mem: mem, in: in, out: out}
+}
+
+func (vm *machine) grow(i int64) {
+	vm.mem = append(vm.mem, make([]int64, i+1-int64(len(vm.mem)))...)
+}
+
+func (vm *machine) get(i int64) int64 {
+	if i >= int64(len(vm.mem)) {
+		vm.grow(i)
+	}
+	return vm.mem[i]
+}
+
+func (vm *machine) set(i int64, v int64) {
+	if i >= int64(len(vm.mem)) {
+		vm.grow(i)
+	}
+	if i < int64(len(codeCells)) && codeCells[i] == '1' && vm.mem[i] != v {
+		vm.selfModified = true
+	}
+	vm.mem[i] = v
+}
+
+func (vm *machine) input() int64 {
+	var v int64
+	if _, err := fmt.Fscan(vm.in, &v); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (vm *machine) output(v int64) {
+	fmt.Fprintln(vm.out, v)
+}
+
+func b2i(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// run executes the transpiled instructions until the program ends, modifies
+// its code or jumps to an address without a transpiled instruction. Then the
+// execution continues in the interpreter.
+func (vm *machine) run() {
+	ip := 0
+	for !vm.selfModified {
+		switch ip {
+{{.Cases -}}
+		default:
+			vm.interpret(ip)
+			return
+		}
+	}
+	vm.interpret(ip)
+}
+
+// interpret executes the program starting at ip.
+func (vm *machine) interpret(ip int) {
+	for ip < len(vm.mem) {
+		ins := vm.mem[ip]
+		op := ins % 100
+		n, ok := argNums[op]
+		if !ok {
+			panic(fmt.Sprintf("unknown opcode %d at %d", op, ip))
+		}
+		var a [3]int64
+		modes := ins / 100
+		for i := 0; i < n; i++ {
+			switch modes % 10 {
+			case 0:
+				a[i] = vm.mem[ip+1+i]
+			case 1:
+				a[i] = int64(ip + 1 + i)
+			case 2:
+				a[i] = vm.rb + vm.mem[ip+1+i]
+			default:
+				panic(fmt.Sprintf("unknown mode %d at %d", modes%10, ip))
+			}
+			modes /= 10
+		}
+		next := ip + 1 + n
+		switch op {
+		case 1:
+			vm.set(a[2], vm.get(a[0])+vm.get(a[1]))
+		case 2:
+			vm.set(a[2], vm.get(a[0])*vm.get(a[1]))
+		case 3:
+			vm.set(a[0], vm.input())
+		case 4:
+			vm.output(vm.get(a[0]))
+		case 5:
+			if vm.get(a[0]) != 0 {
+				next = int(vm.get(a[1]))
+			}
+		case 6:
+			if vm.get(a[0]) == 0 {
+				next = int(vm.get(a[1]))
+			}
+		case 7:
+			vm.set(a[2], b2i(vm.get(a[0]) < vm.get(a[1])))
+		case 8:
+			vm.set(a[2], b2i(vm.get(a[0]) == vm.get(a[1])))
+		case 9:
+			vm.rb += vm.get(a[0])
+		case 10:
+			vm.set(a[2], vm.get(a[0])&vm.get(a[1]))
+		case 11:
+			vm.set(a[2], vm.get(a[0])|vm.get(a[1]))
+		case 12:
+			vm.set(a[2], vm.get(a[0])^vm.get(a[1]))
+		case 13:
+			vm.set(a[2], vm.get(a[0])/vm.get(a[1]))
+		case 14:
+			vm.set(a[2], vm.get(a[0])%vm.get(a[1]))
+		case 15:
+			vm.set(a[2], vm.get(a[0])<<vm.get(a[1]))
+		case 16:
+			vm.set(a[2], vm.get(a[0])>>vm.get(a[1]))
+		case 17:
+			vm.set(a[1], b2i(vm.get(a[0]) == 0))
+		case 18:
+			vm.set(a[0], time.Now().Unix())
+		case 19:
+			vm.set(a[0], rand.Int63())
+		case 20:
+			vm.set(a[1], abs(vm.get(a[0])))
+		case 99:
+			return
+		}
+		ip = next
+	}
+}
+`))
+
+// goBinaryOperators are the Go operators of the instructions with two operands
+// and a result.
+var goBinaryOperators = map[opcode]string{
+	1: "+", 2: "*", 10: "&", 11: "|", 12: "^", 13: "/", 14: "%", 15: "<<", 16: ">>",
+}
+
+// transpileGo writes the program as a Go program, which reads the input from
+// stdin and writes the output to stdout. The transpiled instructions are
+// dispatched by a switch over the IP. The program falls back to an embedded
+// interpreter on self-modifying code and on jumps to other addresses.
+func transpileGo(w io.Writer, a *transpileAnalysis) error {
+	var cases strings.Builder
+	for _, ins := range a.Instructions {
+		fmt.Fprintf(&cases, "case %d: // %s\n", ins.Address, ins.Text)
+		cases.WriteString(goInstruction(ins))
+	}
+
+	var codeCells strings.Builder
+	for _, isCode := range a.CodeCells {
+		codeCells.WriteByte("01"[boolToInt(isCode)])
+	}
+	var argNums []string
+	for op, info := range opcodes {
+		if info.Fn != nil {
+			argNums = append(argNums, fmt.Sprintf("%d: %d", op, info.ArgNum))
+		}
+	}
+
+	var b bytes.Buffer
+	err := goTemplate.Execute(&b, struct {
+		Name       string
+		Code       string
+		MemorySize int
+		CodeCells  string
+		ArgNums    string
+		Cases      string
+	}{
+		Name:       a.Name,
+		Code:       wrapInts(a.Memory[:len(a.CodeCells)], 16),
+		MemorySize: len(a.Memory),
+		CodeCells:  codeCells.String(),
+		ArgNums:    strings.Join(argNums, ", "),
+		Cases:      cases.String(),
+	})
+	if err != nil {
+		return err
+	}
+	source, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(source)
+	return err
+}
+
+// goInstruction returns the Go statements of the instruction, which end by
+// setting ip to the next instruction or returning.
+func goInstruction(ins transpiledInstruction) string {
+	read := func(i int) string {
+		switch ins.Modes[i] {
+		case 1:
+			return "int64(" + strconv.FormatInt(ins.Args[i], 10) + ")"
+		case 2:
+			return fmt.Sprintf("vm.get(vm.rb%+d)", ins.Args[i])
+		default:
+			return fmt.Sprintf("vm.get(%d)", ins.Args[i])
+		}
+	}
+	write := func(i int) string {
+		switch ins.Modes[i] {
+		case 1:
+			return strconv.Itoa(ins.Address + 1 + i)
+		case 2:
+			return fmt.Sprintf("vm.rb%+d", ins.Args[i])
+		default:
+			return strconv.FormatInt(ins.Args[i], 10)
+		}
+	}
+	next := fmt.Sprintf("ip = %d\n", ins.Next())
+
+	if operator, ok := goBinaryOperators[ins.Op]; ok {
+		// The operands are variables, so that the compiler does not evaluate
+		// constant expressions, which would fail on overflows or divisions by
+		// zero.
+		return fmt.Sprintf("x, y := %s, %s\nvm.set(%s, x%sy)\n", read(0), read(1), write(2), operator) + next
+	}
+	switch ins.Op {
+	case 3:
+		return fmt.Sprintf("vm.set(%s, vm.input())\n", write(0)) + next
+	case 4:
+		return fmt.Sprintf("vm.output(%s)\n", read(0)) + next
+	case 5, 6:
+		condition := "!="
+		if ins.Op == 6 {
+			condition = "=="
+		}
+		return fmt.Sprintf("if %s %s 0 {\nip = int(%s)\ncontinue\n}\n", read(0), condition, read(1)) + next
+	case 7:
+		return fmt.Sprintf("vm.set(%s, b2i(%s < %s))\n", write(2), read(0), read(1)) + next
+	case 8:
+		return fmt.Sprintf("vm.set(%s, b2i(%s == %s))\n", write(2), read(0), read(1)) + next
+	case 9:
+		return fmt.Sprintf("vm.rb += %s\n", read(0)) + next
+	case 17:
+		return fmt.Sprintf("vm.set(%s, b2i(%s == 0))\n", write(1), read(0)) + next
+	case 18:
+		return fmt.Sprintf("vm.set(%s, time.Now().Unix())\n", write(0)) + next
+	case 19:
+		return fmt.Sprintf("vm.set(%s, rand.Int63())\n", write(0)) + next
+	case 20:
+		return fmt.Sprintf("vm.set(%s, abs(%s))\n", write(1), read(0)) + next
+	case 99:
+		return "return\n"
+	default:
+		// Syscall does nothing
+		return next
+	}
+}
+
+// wrapInts formats the values as comma separated lines of perLine many values.
+func wrapInts(values ints, perLine int) string {
+	var b strings.Builder
+	for i, v := range values {
+		b.WriteString(strconv.FormatInt(v, 10) + ",")
+		if (i+1)%perLine == 0 || i == len(values)-1 {
+			b.WriteString("\n")
+		} else {
+			b.WriteString(" ")
+		}
+	}
+	return b.String()
+}
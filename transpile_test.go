@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// transpileTests are programs with inputs, whose transpiled versions have to
+// give the same output as Exec.
+var transpileTests = []struct {
+	name   string
+	source string
+	inputs []string
+}{
+	{"day5", "", []string{"1", "5"}},
+	{"day9-quine", day9Quine, []string{""}},
+	{"day9-large-number", day9LargeNumber, []string{""}},
+	// Outputs whether the input is 8, less than 8 or greater than 8
+	{"day5-compare", "3,21,1008,21,8,20,1005,20,22,107,8,21,20,1006,20,31,1106,0,36,98,0,0,1002,21,125,20,4,20,1105,1,46,104,999,1105,1,46,1101,1000,1,20,4,20,1105,1,46,98,99",
+		[]string{"7", "8", "9"}},
+	// Calls a function doubling the input with the return address on a stack
+	// at the relative base, which returns by a jump to a relative address
+	{"call", "109,100,3,50,21101,13,0,0,109,1,1105,1,19,4,50,99,0,0,0,109,-1,1002,50,2,50,2106,0,0",
+		[]string{"21"}},
+	// The add at 0 is replaced by a multiply and executed again
+	{"selfmod", "1101,5,5,200,1001,201,1,201,1008,201,2,202,1005,202,22,1101,0,1102,0,1105,1,0,4,200,99", []string{""}},
+	// Outputs the double of the first input and the sum of the first and the
+	// third input, which are separated by blank lines and spaces
+	{"inputs", "3,20,1002,20,2,21,4,21,3,22,3,22,1,20,22,23,4,23,99",
+		[]string{"3\n\n5\n4\n", "3\n\n\n5\n\n4\n\n", "  3 5\t4  \n"}},
+	// Additional instructions
+	{"additional", "1110,12,10,100,1111,12,10,101,1112,12,10,102,1113,12,5,103,1114,12,5,104,1115,3,2,105,1116,12,1,106,1117,0,107,1120,-7,108," +
+		"4,100,4,101,4,102,4,103,4,104,4,105,4,106,4,107,4,108,99", []string{""}},
+	// Overflows and shifts, which are undefined in C
+	{"overflow", "1102,4611686018427387904,4,100,1101,9223372036854775807,1,101,1115,1,64,102,1116,-8,70,103,1113,-9223372036854775808,-1,104,1120,-9223372036854775808,105," +
+		"4,100,4,101,4,102,4,103,4,104,4,105,99", []string{""}},
+}
+
+// execOutput returns the output of executing source with input.
+func execOutput(source string, input string) string {
+	var out bytes.Buffer
+	p := New(source, 42)
+	p.InputReader = strings.NewReader(input)
+	p.OutputWriter = &out
+	p.Exec()
+	return out.String()
+}
+
+func TestTranspileGo(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	testTranspiled(t, transpileGo, ".go", func(source string, binary string) *exec.Cmd {
+		return exec.Command("go", "build", "-o", binary, source)
+	})
+}
+
+func TestTranspileC(t *testing.T) {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("cc is not installed")
+	}
+	testTranspiled(t, transpileC, ".c", func(source string, binary string) *exec.Cmd {
+		return exec.Command("cc", "-std=c99", "-pedantic", "-Wall", "-Wextra", "-Werror", "-O2", "-o", binary, source)
+	})
+}
+
+// testTranspiled transpiles each of the transpileTests, builds it by the
+// command returned by build and checks its outputs.
+func testTranspiled(t *testing.T, transpile func(io.Writer, *transpileAnalysis) error, extension string,
+	build func(source string, binary string) *exec.Cmd) {
+	day5, err := ioutil.ReadFile("examples/program.ic")
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	for _, test := range transpileTests {
+		source := test.source
+		if test.name == "day5" {
+			source = string(day5)
+		}
+		p := New(source, 42)
+		var transpiled bytes.Buffer
+		assert.NoError(t, transpile(&transpiled, analyzeProgram(test.name, p.Ints, p.CodeLen)), test.name)
+		sourceFilename := filepath.Join(dir, test.name+extension)
+		assert.NoError(t, ioutil.WriteFile(sourceFilename, transpiled.Bytes(), 0664))
+
+		binary := filepath.Join(dir, test.name)
+		cmd := build(sourceFilename, binary)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s: %s\n%s", test.name, err, output)
+		}
+
+		for _, input := range test.inputs {
+			run := exec.Command(binary)
+			run.Stdin = strings.NewReader(input)
+			run.Stderr = os.Stderr
+			output, err := run.Output()
+			assert.NoError(t, err, test.name)
+			assert.Equal(t, execOutput(source, input), string(output), test.name+" with input "+input)
+		}
+	}
+}
+
+func TestAnalyzeProgram(t *testing.T) {
+	// The data at 5 is no instruction, the output at 7 is reached by the jump
+	// at 2 and the halt at 9 ends the search
+	p := New("3,20,1105,1,7,42,42,4,20,99,5,5", 0)
+	a := analyzeProgram("test", p.Ints, p.CodeLen)
+	addresses := []int{}
+	for _, ins := range a.Instructions {
+		addresses = append(addresses, ins.Address)
+	}
+	assert.Equal(t, []int{0, 2, 7, 9}, addresses)
+	assert.Equal(t, []bool{true, true, true, true, true, false, false, true, true, true, false, false}, a.CodeCells)
+}